@@ -1,11 +1,13 @@
 package cli
 
 import (
+	"encoding/json"
 	"flag"
 	"fmt"
 	"os"
 	"strings"
 
+	"github.com/puppetlabs/regulator/exitcode"
 	"github.com/puppetlabs/regulator/rgerror"
 	"github.com/puppetlabs/regulator/version"
 )
@@ -16,6 +18,20 @@ type Command struct {
 	ExecutionFn func()
 }
 
+// StringList is a flag.Value for flags that can be passed more than
+// once, e.g. --file a.yaml --file b.yaml. Values are kept in the order
+// they were passed.
+type StringList []string
+
+func (sl *StringList) String() string {
+	return strings.Join(*sl, ",")
+}
+
+func (sl *StringList) Set(value string) error {
+	*sl = append(*sl, value)
+	return nil
+}
+
 // shouldHaveArgs does two things:
 // * validate that the number of args that aren't flags have been provided (i.e. the number of strings
 //    after the command name that aren't flags)
@@ -42,7 +58,7 @@ func ShouldHaveArgs(num_args int, usage string, description string, flagset *fla
 				fmt.Fprintf(os.Stderr, "Available flags:\n")
 				flagset.PrintDefaults()
 			}
-			os.Exit(1)
+			os.Exit(exitcode.USAGE)
 		}
 	}
 	if len(os.Args) < real_args {
@@ -51,20 +67,55 @@ func ShouldHaveArgs(num_args int, usage string, description string, flagset *fla
 			fmt.Fprintf(os.Stderr, "Available flags:\n")
 			flagset.PrintDefaults()
 		}
-		os.Exit(1)
+		os.Exit(exitcode.USAGE)
 	} else if len(os.Args) > real_args && passed_fs {
 		flagset.Parse(os.Args[real_args:])
 	}
 }
 
+// The shape errors are printed in with --error-format json. Kind is the
+// kind's Name, which won't change, and origin is the text of the error
+// that caused this one. Every field but findings is always there, empty
+// if the error doesn't have one.
+type jsonError struct {
+	Kind      string            `json:"kind"`
+	Message   string            `json:"message"`
+	Origin    string            `json:"origin"`
+	Operation string            `json:"operation"`
+	Hint      string            `json:"hint"`
+	Findings  []rgerror.Finding `json:"findings,omitempty"`
+}
+
 // handleCommandRGerror catches InvalidInput rgerror.RGerrors and prints usage
 // if that was the error thrown. IF a different type of rgerror.RGerror is thrown
 // it just prints the error.
 //
+// If the flagset has an error-format flag set to json the error is printed
+// as a single JSON object instead, so editors and CI can pick out findings.
+//
 // If the command succeeds handleCommandRGerror exits the whole go process
-// with code 0
+// with code 0, otherwise with the code for the error (see the exitcode
+// package)
 func HandleCommandRGerror(rgerr *rgerror.RGerror, usage string, description string, flagset *flag.FlagSet) {
 	if rgerr != nil {
+		if wantsJsonErrors(flagset) {
+			origin := ""
+			if rgerr.Origin != nil {
+				origin = rgerr.Origin.Error()
+			}
+			json_output, err := json.Marshal(jsonError{
+				Kind:      rgerr.Kind.Name(),
+				Message:   rgerr.Message,
+				Origin:    origin,
+				Operation: rgerr.Operation,
+				Hint:      rgerr.Hint,
+				Findings:  rgerr.Findings,
+			})
+			if err == nil {
+				fmt.Fprintf(os.Stderr, "%s\n", json_output)
+				os.Exit(exitcode.ForError(rgerr))
+			}
+		}
 		if rgerr.Kind == rgerror.InvalidInput {
 			fmt.Fprintf(os.Stderr, "%s\nUsage:\n  %s\n\nDescription:\n  %s\n\n", rgerr, usage, description)
 			if flagset != nil {
@@ -73,9 +124,27 @@ func HandleCommandRGerror(rgerr *rgerror.RGerror, usage string, description stri
 		} else {
 			fmt.Fprintf(os.Stderr, "Error running command:\n\n%s\n", rgerr)
 		}
-		os.Exit(1)
+		os.Exit(exitcode.ForError(rgerr))
+	}
+	os.Exit(exitcode.OK)
+}
+
+// The same as HandleCommandRGerror, for commands that print results and
+// exit with a code saying what the results were, e.g. whether any
+// observations failed
+func HandleCommandResult(exit_code int, rgerr *rgerror.RGerror, usage string, description string, flagset *flag.FlagSet) {
+	if rgerr != nil {
+		HandleCommandRGerror(rgerr, usage, description, flagset)
+	}
+	os.Exit(exit_code)
+}
+
+func wantsJsonErrors(flagset *flag.FlagSet) bool {
+	if flagset == nil {
+		return false
 	}
-	os.Exit(0)
+	error_format := flagset.Lookup("error-format")
+	return error_format != nil && error_format.Value.String() == "json"
 }
 
 func RunCommand(tool_name string, command_list []Command) {
@@ -105,5 +174,5 @@ func RunCommand(tool_name string, command_list []Command) {
 	for _, command := range command_list {
 		fmt.Printf("    %s %s\n", command.Verb, command.Noun)
 	}
-	os.Exit(1)
+	os.Exit(exitcode.USAGE)
 }
@@ -6,9 +6,9 @@ import (
 	"net"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/puppetlabs/regulator/rgerror"
-	"github.com/puppetlabs/regulator/sanitize"
 	"golang.org/x/crypto/ssh"
 	"golang.org/x/crypto/ssh/agent"
 )
@@ -35,7 +35,7 @@ func openConnectionWithAgent(username string, target string, port string) (*ssh.
 		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
 	}
 
-	ssh_client, err := ssh.Dial("tcp", target+":"+port, config)
+	ssh_client, err := ssh.Dial("tcp", net.JoinHostPort(target, port), config)
 	if err != nil {
 		return nil, &rgerror.RGerror{
 			Kind:    rgerror.ExecError,
@@ -46,7 +46,10 @@ func openConnectionWithAgent(username string, target string, port string) (*ssh.
 	return ssh_client, nil
 }
 
-func RunSSHCommand(command string, send_stdin string, username string, target string, port string) (string, string, int, *rgerror.RGerror) {
+// If timeout is more than 0 and the command hasn't finished by then the
+// session and connection are torn down, which ends the remote command
+// along with them
+func RunSSHCommand(command string, send_stdin string, username string, target string, port string, timeout time.Duration) (string, string, int, *rgerror.RGerror) {
 	client, rgerr := openConnectionWithAgent(username, target, port)
 	if rgerr != nil {
 		return "", "", -1, rgerr
@@ -68,9 +71,35 @@ func RunSSHCommand(command string, send_stdin string, username string, target st
 	if len(send_stdin) > 0 {
 		session.Stdin = strings.NewReader(send_stdin)
 	}
-	err = session.Run(command)
-	command_stdout := sanitize.ReplaceAllNewlines(read_stdout.String())
-	command_stderr := sanitize.ReplaceAllNewlines(read_stderr.String())
+	done := make(chan error, 1)
+	go func() {
+		done <- session.Run(command)
+	}()
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		select {
+		case err = <-done:
+		case <-timer.C:
+			// Not every ssh server supports signals, closing the session
+			// and connection is what actually makes sure it ends
+			session.Signal(ssh.SIGKILL)
+			session.Close()
+			client.Close()
+			<-done
+			return read_stdout.String(), read_stderr.String(), -1, &rgerror.RGerror{
+				Kind:    rgerror.TimeoutError,
+				Message: fmt.Sprintf("Remote command \"%s\" on %s did not finish within %s, the ssh session was closed", command, target, timeout),
+				Origin:  nil,
+			}
+		}
+	} else {
+		err = <-done
+	}
+	// Passed back byte for byte, stdout is usually the JSON results from
+	// the remote regulator
+	command_stdout := read_stdout.String()
+	command_stderr := read_stderr.String()
 	if err != nil {
 		// This whole thing is insane, but when session.Run() returns
 		// from executing a remote command and the command returned
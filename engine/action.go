@@ -0,0 +1,96 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/puppetlabs/regulator/operation"
+	"github.com/puppetlabs/regulator/operparse"
+	"github.com/puppetlabs/regulator/rgerror"
+	"github.com/puppetlabs/regulator/validator"
+)
+
+// Runs an action a single time, with its args and env already computed. In
+// noop mode the action is told not to change anything through the
+// environment as well as its args (see operparse.NOOP_ENV_VAR)
+func (engn *Engine) runActionOnce(ctx context.Context, actn operation.Action, noop bool) operation.ActionResult {
+	result := operation.ActionResult{
+		Action: actn,
+	}
+	timeout, err := operparse.ParseTimeout(actn.Timeout)
+	if err != nil {
+		result.Succeeded = false
+		result.Logs = "Error: Action has an invalid timeout: " + err.Error()
+		return result
+	}
+	output, logs, info, cmd_rgerr := engn.executor.Execute(ctx, Command{
+		Exe:     actn.Exe,
+		Path:    actn.Path,
+		Script:  actn.Script,
+		Args:    actn.Args,
+		Options: execOptions(actn.Environment, actn.Become, timeout, noop),
+	})
+	if cmd_rgerr != nil {
+		result.Succeeded = false
+		result.Timed_Out = cmd_rgerr.Kind == rgerror.TimeoutError
+		result.Output = operation.CleanOutput(actn.Output, output)
+		result.Logs = fmt.Sprintf("Error: %s, Logs: %s", cmd_rgerr.Message, operation.CleanLogs(logs))
+	} else {
+		result.Succeeded = true
+		result.Output = operation.CleanOutput(actn.Output, output)
+		result.Logs = operation.CleanLogs(logs)
+	}
+	result.Execution = execution(info)
+	return result
+}
+
+// Runs an action as it is, with its args and env already computed (see
+// operparse.ComputeNoopArgs), retrying it if it fails and has retries set.
+// name is only used for the hooks.
+func (engn *Engine) RunPreparedAction(ctx context.Context, name string, actn operation.Action, noop bool) operation.ActionResult {
+	if engn.hooks.Before_Action != nil {
+		engn.hooks.Before_Action(name)
+	}
+	var result operation.ActionResult
+	attempts, history := runWithRetries(ctx, actn.Retry, func() (bool, bool, string) {
+		result = engn.runActionOnce(ctx, actn, noop)
+		return result.Succeeded, result.Timed_Out, result.Logs
+	})
+	if actn.Retries > 0 {
+		result.Attempts = attempts
+		result.Logs = withRetryHistory(history, result.Logs)
+	}
+	if engn.hooks.After_Action != nil {
+		engn.hooks.After_Action(name, result)
+	}
+	return result
+}
+
+// Runs the action called actn_name in ops, never in noop mode (even if the
+// engine is). A failed action is a result like any other, errors are for
+// when it couldn't be run at all.
+func (engn *Engine) RunAction(ctx context.Context, ops *operation.Operations, actn_name string) (*operation.ActionResults, *rgerror.RGerror) {
+	rgerr := validator.Validate(
+		validator.Param{Name: "action name", Value: actn_name, Rules: []validator.Rule{validator.NotEmpty}},
+	)
+	if rgerr != nil {
+		return nil, rgerr
+	}
+	actn := operparse.SelectAction(actn_name, ops.Actions)
+	if actn == nil {
+		return nil, &rgerror.RGerror{
+			Kind:      rgerror.InvalidInput,
+			Message:   fmt.Sprintf("Name \"%s\" does not match any existing action names", actn_name),
+			Origin:    nil,
+			Operation: fmt.Sprintf("action '%s'", actn_name),
+		}
+	}
+	actn.Args = operparse.ComputeNoopArgs(actn.Args, false)
+	actn.Env = operparse.ComputeNoopEnv(actn.Env, false)
+	result := engn.RunPreparedAction(ctx, actn_name, *actn, false)
+	raw_final_result := operation.ActionResults{Actions: make(map[string]operation.ActionResult)}
+	raw_final_result.Actions[actn_name] = result
+	// The result for actions (for now) is an actionresults set with one action
+	// result in the actions field.
+	return &raw_final_result, nil
+}
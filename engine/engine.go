@@ -0,0 +1,99 @@
+package engine
+
+import (
+	"context"
+
+	"github.com/puppetlabs/regulator/localexec"
+	"github.com/puppetlabs/regulator/operation"
+	"github.com/puppetlabs/regulator/rgerror"
+)
+
+// Runs specs and returns their results as structs, for embedding regulator
+// in other Go programs. The CLI (see the local package) is a wrapper around
+// this that loads specs and prints the results.
+//
+// Specs are taken as they are, so anything that should happen to them
+// first (e.g. operparse.ApplyDefaultTimeout or operparse.SelectOperations)
+// is up to the caller. An Engine can be used for any number of runs, and
+// from more than one goroutine at once as long as its Executor and Hooks
+// can be.
+//
+// Everything an Engine runs, runs on this machine (or wherever its
+// Executor sends it). To run a spec with the regulator installed on
+// another machine, see remote.ObserveResults and the others next to it,
+// which return the same structs.
+type Engine struct {
+	parallelism int
+	noop        bool
+	executor    Executor
+	hooks       Hooks
+}
+
+type Options struct {
+	// How many observations can run at once, anything below 1 runs them
+	// one at a time
+	Parallelism int
+	// React only runs actions that support noop, in noop mode, and plans
+	// the rest. See Engine.Plan to run nothing at all.
+	Noop bool
+	// Runs every implement and action, a LocalExecutor if not set
+	Executor Executor
+	Hooks    Hooks
+}
+
+// Runs the command for an implement or action. Whatever it runs on, it
+// should behave like localexec.BuildAndRunCommand: stdout and stderr are
+// returned exactly as printed, and an error means the command failed
+// (TimeoutError if it was killed for running past opts.Timeout).
+type Executor interface {
+	Execute(ctx context.Context, cmd Command) (string, string, localexec.ExecInfo, *rgerror.RGerror)
+}
+
+// Everything needed to run an implement or action, with its args and env
+// already computed
+type Command struct {
+	Exe string
+	// Only one of Path or Script is set, if either is. Exe is run with
+	// the file (a temp file for Script) as its first arg.
+	Path    string
+	Script  string
+	Args    []string
+	Options localexec.ExecOptions
+}
+
+// Runs commands on this machine
+type LocalExecutor struct{}
+
+func (exctr LocalExecutor) Execute(ctx context.Context, cmd Command) (string, string, localexec.ExecInfo, *rgerror.RGerror) {
+	return localexec.BuildAndRunCommandWithContext(ctx, cmd.Exe, cmd.Path, cmd.Script, cmd.Args, cmd.Options)
+}
+
+// Called as a run goes along, e.g. to log or show progress. Any of them
+// can be left nil. Observations can run in parallel, so the observation
+// hooks have to be safe to call from more than one goroutine at once.
+//
+// Actions run by reactions get the action hooks as well as the reaction
+// ones, named after the action (or implement) that was run. Retried
+// observations and actions only get one call of each, around all of the
+// attempts.
+type Hooks struct {
+	Before_Observation func(name string)
+	After_Observation  func(name string, result operation.ObservationResult)
+	Before_Reaction    func(name string)
+	After_Reaction     func(name string, result operation.ReactionResult)
+	Before_Action      func(name string)
+	After_Action       func(name string, result operation.ActionResult)
+}
+
+func New(opts Options) *Engine {
+	executor := opts.Executor
+	if executor == nil {
+		executor = LocalExecutor{}
+	}
+	return &Engine{
+		parallelism: opts.Parallelism,
+		noop:        opts.Noop,
+		executor:    executor,
+		hooks:       opts.Hooks,
+	}
+}
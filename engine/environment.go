@@ -0,0 +1,41 @@
+package engine
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/puppetlabs/regulator/localexec"
+	"github.com/puppetlabs/regulator/operation"
+	"github.com/puppetlabs/regulator/operparse"
+)
+
+// Builds the options to run an action or implement with, as whoever it
+// should become. Its env should already have been computed (see
+// operparse.ComputeEnv). The noop variable is added last so nothing in the
+// spec can override it.
+func execOptions(environment operation.Environment, become operation.Become, timeout time.Duration, noop bool) localexec.ExecOptions {
+	opts := localexec.ExecOptions{
+		Timeout:     timeout,
+		Dir:         environment.Cwd,
+		Clean_Env:   environment.Clean_Env,
+		Become_Exe:  become.Exe(),
+		Become_User: become.Become_User,
+	}
+	if environment.Clean_Env {
+		opts.Keep_Env = append(append([]string{}, operation.CLEAN_ENV_ALWAYS_KEPT...), environment.Keep_Env...)
+	}
+	// Sorted so the command always sees its environment in the same order
+	names := make([]string, 0, len(environment.Env))
+	for name := range environment.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		opts.Extra_Env = append(opts.Extra_Env, name+"="+environment.Env[name])
+	}
+	// Always set, so one left in regulator's own environment can't make
+	// a real run a noop (or the other way around)
+	opts.Extra_Env = append(opts.Extra_Env, fmt.Sprintf("%s=%t", operparse.NOOP_ENV_VAR, noop))
+	return opts
+}
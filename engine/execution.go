@@ -0,0 +1,41 @@
+package engine
+
+import (
+	"os"
+	"time"
+
+	"github.com/puppetlabs/regulator/localexec"
+	"github.com/puppetlabs/regulator/operation"
+)
+
+// Looked up once, it's the same for every result
+var hostname string = func() string {
+	name, err := os.Hostname()
+	if err != nil {
+		return ""
+	}
+	return name
+}()
+
+func execution(info localexec.ExecInfo) operation.Execution {
+	result := operation.Execution{
+		Started_At:  info.Started_At.Format(time.RFC3339Nano),
+		Duration_Ms: info.Duration.Milliseconds(),
+		Hostname:    hostname,
+		Command:     info.Command,
+	}
+	if info.Started {
+		exit_code := info.Exit_Code
+		result.Exit_Code = &exit_code
+	}
+	return result
+}
+
+// Timing for a whole run that started at started_at
+func runTiming(started_at time.Time) operation.RunTiming {
+	return operation.RunTiming{
+		Started_At:  started_at.Format(time.RFC3339Nano),
+		Duration_Ms: time.Since(started_at).Milliseconds(),
+		Hostname:    hostname,
+	}
+}
@@ -0,0 +1,225 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/puppetlabs/regulator/expression"
+	"github.com/puppetlabs/regulator/operation"
+	"github.com/puppetlabs/regulator/operparse"
+	"github.com/puppetlabs/regulator/render"
+	"github.com/puppetlabs/regulator/rgerror"
+)
+
+// Parses the output of an implement with 'output: json'. If the observation
+// has an expect_path the selected value becomes the result compared with
+// Expect, otherwise the whole output is.
+//
+// Selected strings are used as-is, anything else is rendered back to JSON
+// so that e.g. a selected number 3 can be expected as "3"
+func parseJsonResult(output string, obsv operation.Observation) (interface{}, string, *rgerror.RGerror) {
+	var data interface{}
+	err := json.Unmarshal([]byte(output), &data)
+	if err != nil {
+		return nil, "", &rgerror.RGerror{
+			Kind:    rgerror.ExecError,
+			Message: fmt.Sprintf("Implement output is not valid JSON: %s", err),
+			Origin:  err,
+		}
+	}
+	if obsv.Expect_Path == "" {
+		return data, operation.CleanOutput(operation.OUTPUT_SINGLE_LINE, output), nil
+	}
+	path, rgerr := expression.ParsePath(obsv.Expect_Path)
+	if rgerr != nil {
+		return nil, "", rgerr
+	}
+	selected, rgerr := path.Select(data)
+	if rgerr != nil {
+		return nil, "", rgerr
+	}
+	if selected_string, ok := selected.(string); ok {
+		return data, selected_string, nil
+	}
+	rendered, rgerr := render.RenderJson(selected)
+	if rgerr != nil {
+		return nil, "", rgerr
+	}
+	return data, rendered, nil
+}
+
+// Runs the implement for an observation once
+func (engn *Engine) runObservationImplement(ctx context.Context, name string, obsv operation.Observation, impl operation.Implement) operation.ObservationResult {
+	impl_file := impl.Path
+	impl_script := impl.Script
+	executable := impl.Exe
+	args := operparse.ComputeArgs(impl.Observes.Args, obsv, false)
+	timeout, err := operparse.ParseTimeout(impl.Timeout)
+	if err != nil {
+		return operation.ObservationResult{
+			Succeeded:   false,
+			Result:      "Error: Implement has an invalid timeout: " + err.Error(),
+			Observation: obsv,
+		}
+	}
+	environment := impl.Environment
+	environment.Env = operparse.ComputeEnv(impl.Env, obsv, false)
+	output, logs, info, cmd_rgerr := engn.executor.Execute(ctx, Command{
+		Exe:     executable,
+		Path:    impl_file,
+		Script:  impl_script,
+		Args:    args,
+		Options: execOptions(environment, impl.Become, timeout, false),
+	})
+	logs = operation.CleanLogs(logs)
+	if cmd_rgerr != nil {
+		return operation.ObservationResult{
+			Succeeded:   false,
+			Timed_Out:   cmd_rgerr.Kind == rgerror.TimeoutError,
+			Result:      "Error: " + strings.TrimSpace(cmd_rgerr.Message),
+			Expected:    false,
+			Logs:        logs,
+			Observation: obsv,
+			Execution:   execution(info),
+		}
+	} else {
+		result := operation.ObservationResult{
+			Succeeded:   true,
+			Result:      operation.CleanOutput(impl.Output, output),
+			Logs:        logs,
+			Observation: obsv,
+			Execution:   execution(info),
+		}
+		if impl.Output == operation.IMPLEMENT_OUTPUT_JSON {
+			data, selected, rgerr := parseJsonResult(output, obsv)
+			if rgerr != nil {
+				result.Succeeded = false
+				result.Result = "Error: " + strings.TrimSpace(rgerr.Message)
+				return result
+			}
+			result.Data = data
+			result.Result = selected
+		} else if obsv.Expect_Path != "" {
+			result.Succeeded = false
+			result.Result = "Error: Observation '" + name + "' has an expect_path but its implement does not have 'output: json'"
+			return result
+		}
+		if obsv.Expect.Matches(result.Result) {
+			result.Expected = true
+		} else {
+			result.Expected = false
+		}
+		return result
+	}
+}
+
+// Runs a single observation with the implement in impls that observes it.
+// The observation's retry settings are used if it has any, otherwise the
+// implement's are.
+func (engn *Engine) RunObservation(ctx context.Context, name string, obsv operation.Observation, impls map[string]operation.Implement) operation.ObservationResult {
+	if engn.hooks.Before_Observation != nil {
+		engn.hooks.Before_Observation(name)
+	}
+	result := engn.runObservation(ctx, name, obsv, impls)
+	if engn.hooks.After_Observation != nil {
+		engn.hooks.After_Observation(name, result)
+	}
+	return result
+}
+
+func (engn *Engine) runObservation(ctx context.Context, name string, obsv operation.Observation, impls map[string]operation.Implement) operation.ObservationResult {
+	_, impl := operparse.SelectObservingImplement(obsv, impls)
+	if impl == nil {
+		return operation.ObservationResult{
+			Succeeded:   false,
+			Result:      "Error: No implement found for observation '" + name + "'",
+			Observation: obsv,
+		}
+	}
+	retry := obsv.Retry
+	if !retry.IsSet() {
+		retry = impl.Retry
+	}
+	var result operation.ObservationResult
+	attempts, history := runWithRetries(ctx, retry, func() (bool, bool, string) {
+		result = engn.runObservationImplement(ctx, name, obsv, *impl)
+		return result.Succeeded, result.Timed_Out, result.Result
+	})
+	if retry.Retries > 0 {
+		result.Attempts = attempts
+		result.Logs = withRetryHistory(history, result.Logs)
+	}
+	return result
+}
+
+// Runs every observation in ops, up to the engine's parallelism of them at
+// once. Observations using an implement with 'serial: true' never run at
+// the same time as each other, even when parallelism allows it.
+//
+// If ctx is done before everything has run, anything still running is
+// killed and whatever hasn't run yet fails straight away, saying it was
+// cancelled (or timed out, for a ctx with a deadline).
+func (engn *Engine) Observe(ctx context.Context, ops *operation.Operations) (*operation.ObservationResults, *rgerror.RGerror) {
+	results := engn.observeAll(ctx, ops.Observations, ops.Implements)
+	return &results, nil
+}
+
+func (engn *Engine) observeAll(ctx context.Context, obsvs map[string]operation.Observation, impls map[string]operation.Implement) operation.ObservationResults {
+	started_at := time.Now()
+	results := operation.ObservationResults{Observations: make(map[string]operation.ObservationResult)}
+	parallelism := engn.parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+
+	serial_locks := make(map[string]*sync.Mutex)
+	for impl_name, impl := range impls {
+		if impl.Serial {
+			serial_locks[impl_name] = &sync.Mutex{}
+		}
+	}
+
+	var results_lock sync.Mutex
+	var workers sync.WaitGroup
+	obsv_names := make(chan string)
+	for i := 0; i < parallelism; i++ {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			for obsv_name := range obsv_names {
+				obsv := obsvs[obsv_name]
+				impl_name, _ := operparse.SelectObservingImplement(obsv, impls)
+				serial_lock := serial_locks[impl_name]
+				if serial_lock != nil {
+					serial_lock.Lock()
+				}
+				this_result := engn.RunObservation(ctx, obsv_name, obsv, impls)
+				if serial_lock != nil {
+					serial_lock.Unlock()
+				}
+
+				results_lock.Lock()
+				results.Observations[obsv_name] = this_result
+				results.Total_Observations++
+				if this_result.Succeeded == false {
+					results.Failed_Observations++
+				}
+				if this_result.Expected == false {
+					results.Unexpected_Observations++
+				}
+				results_lock.Unlock()
+			}
+		}()
+	}
+	for obsv_name := range obsvs {
+		obsv_names <- obsv_name
+	}
+	close(obsv_names)
+	workers.Wait()
+	results.RunTiming = runTiming(started_at)
+	return results
+}
@@ -0,0 +1,529 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/puppetlabs/regulator/expression"
+	"github.com/puppetlabs/regulator/operation"
+	"github.com/puppetlabs/regulator/operparse"
+	"github.com/puppetlabs/regulator/rgerror"
+)
+
+// Runs every observation in ops, then reacts to the results. With the
+// engine in noop mode, reactions only run actions that support noop, in
+// noop mode (Would_Change says whether they'd change anything), and the
+// rest are planned like Plan does.
+//
+// Observing is part of reacting, so it's included in RunTiming.
+func (engn *Engine) React(ctx context.Context, ops *operation.Operations) (*operation.ReactionResults, *rgerror.RGerror) {
+	mode := reactApply
+	if engn.noop {
+		mode = reactNoop
+	}
+	return engn.observeAndReact(ctx, ops, mode)
+}
+
+// Works out what React would do without running any actions or implement
+// reactions, observations still run since they're needed to know what
+// would happen. Conditions, 'when' expressions, dependencies, and
+// correction selection all go through exactly the same code as React,
+// every reaction that would run gets a Would_Run with the action and its
+// computed args.
+//
+// Reactions that would run count as succeeded, so anything that depends on
+// them is planned as if they worked.
+func (engn *Engine) Plan(ctx context.Context, ops *operation.Operations) (*operation.ReactionResults, *rgerror.RGerror) {
+	return engn.observeAndReact(ctx, ops, reactPlan)
+}
+
+// The reacting half of React, for results that were already observed (or
+// came from somewhere else). RunTiming isn't set.
+func (engn *Engine) ReactTo(ctx context.Context, ops *operation.Operations, obsv_results operation.ObservationResults) (*operation.ReactionResults, *rgerror.RGerror) {
+	mode := reactApply
+	if engn.noop {
+		mode = reactNoop
+	}
+	return engn.reactTo(ctx, ops, obsv_results, mode)
+}
+
+// The same as ReactTo, for Plan
+func (engn *Engine) PlanReactions(ctx context.Context, ops *operation.Operations, obsv_results operation.ObservationResults) (*operation.ReactionResults, *rgerror.RGerror) {
+	return engn.reactTo(ctx, ops, obsv_results, reactPlan)
+}
+
+func (engn *Engine) observeAndReact(ctx context.Context, ops *operation.Operations, mode reactMode) (*operation.ReactionResults, *rgerror.RGerror) {
+	started_at := time.Now()
+	obsv_results := engn.observeAll(ctx, ops.Observations, ops.Implements)
+	results, rgerr := engn.reactTo(ctx, ops, obsv_results, mode)
+	if rgerr != nil {
+		return nil, rgerr
+	}
+	results.RunTiming = runTiming(started_at)
+	return results, nil
+}
+
+// How reactions that pass their checks are handled
+type reactMode int
+
+const (
+	// Run the action
+	reactApply reactMode = iota
+	// Don't run anything, just record what would have run
+	reactPlan
+	// Run actions that support noop in noop mode, and treat the rest
+	// like reactPlan
+	reactNoop
+)
+
+func plannedReaction(rctn operation.Reaction, actn_name string, actn *operation.Action, message string) operation.ReactionResult {
+	return operation.ReactionResult{
+		Succeeded: true,
+		Skipped:   false,
+		Output:    "",
+		Logs:      "",
+		Message:   message,
+		Reaction:  rctn,
+		Would_Run: &operation.PlannedAction{
+			Name:   actn_name,
+			Action: *actn,
+		},
+	}
+}
+
+// Asks the action what it would change, following the noop protocol
+// described in operparse
+func (engn *Engine) runNoopReaction(ctx context.Context, rctn operation.Reaction, actn_name string, actn *operation.Action) operation.ReactionResult {
+	action_result := engn.RunPreparedAction(ctx, actn_name, *actn, true)
+	result := plannedReaction(rctn, actn_name, actn, "")
+	result.Output = action_result.Output
+	result.Logs = action_result.Logs
+	result.Execution = action_result.Execution
+	if !action_result.Succeeded {
+		result.Succeeded = false
+		result.Timed_Out = action_result.Timed_Out
+		result.Message = "Error running '" + actn_name + "' in noop mode"
+		return result
+	}
+	var would_change bool
+	switch strings.TrimSpace(action_result.Output) {
+	case operparse.NOOP_WOULD_CHANGE:
+		would_change = true
+		result.Message = "Ran '" + actn_name + "' in noop mode, it would change something"
+	case operparse.NOOP_NO_CHANGE:
+		would_change = false
+		result.Message = "Ran '" + actn_name + "' in noop mode, it would not change anything"
+	default:
+		result.Succeeded = false
+		result.Message = fmt.Sprintf(
+			"Ran '%s' in noop mode but it answered '%s', expected '%s' or '%s'",
+			actn_name,
+			strings.TrimSpace(action_result.Output),
+			operparse.NOOP_WOULD_CHANGE,
+			operparse.NOOP_NO_CHANGE,
+		)
+		return result
+	}
+	result.Would_Change = &would_change
+	return result
+}
+
+// Works out whether the action supports noop (before __noop__ is replaced
+// in its args) and computes its args and env. Plain actions have no
+// observation to take an instance from.
+func prepareAction(actn *operation.Action, obsv *operation.Observation, mode reactMode) {
+	actn.Supports_Noop = operparse.SupportsNoop(*actn)
+	noop := mode == reactNoop && actn.Supports_Noop
+	if obsv == nil {
+		actn.Args = operparse.ComputeNoopArgs(actn.Args, noop)
+		actn.Env = operparse.ComputeNoopEnv(actn.Env, noop)
+	} else {
+		actn.Args = operparse.ComputeArgs(actn.Args, *obsv, noop)
+		actn.Env = operparse.ComputeEnv(actn.Env, *obsv, noop)
+	}
+}
+
+func (engn *Engine) runReaction(ctx context.Context, check_result bool, rctn operation.Reaction, actn_name string, actn *operation.Action, skipped_message string, mode reactMode) operation.ReactionResult {
+	if check_result && mode == reactPlan {
+		return plannedReaction(rctn, actn_name, actn, "Would run '"+actn_name+"'")
+	}
+	if check_result && mode == reactNoop {
+		if actn.Supports_Noop {
+			return engn.runNoopReaction(ctx, rctn, actn_name, actn)
+		}
+		return plannedReaction(rctn, actn_name, actn, "Would run '"+actn_name+"', not run because it does not support noop")
+	}
+	if check_result {
+		action_result := engn.RunPreparedAction(ctx, actn_name, *actn, false)
+		if !action_result.Succeeded {
+			return operation.ReactionResult{
+				Succeeded: false,
+				Skipped:   false,
+				Timed_Out: action_result.Timed_Out,
+				Output:    action_result.Output,
+				Logs:      action_result.Logs,
+				Message:   "Error running '" + actn_name + "'",
+				Reaction:  rctn,
+				Execution: action_result.Execution,
+			}
+		} else {
+			return operation.ReactionResult{
+				Succeeded: true,
+				Skipped:   false,
+				Output:    action_result.Output,
+				Logs:      action_result.Logs,
+				Message:   "Successfully ran '" + actn_name + "'",
+				Reaction:  rctn,
+				Execution: action_result.Execution,
+			}
+		}
+	} else {
+		return operation.ReactionResult{
+			Succeeded: true,
+			Skipped:   true,
+			Output:    "",
+			Logs:      "",
+			Message:   skipped_message,
+			Reaction:  rctn,
+		}
+	}
+}
+
+// Implements can exit 0 without actually changing anything, so once a
+// correction has run the observation is run again to make sure the
+// entity really ended up in the state the correction promised. The
+// reaction only counts as succeeded if it did.
+func (engn *Engine) verifyCorrection(ctx context.Context, result operation.ReactionResult, rctn operation.Reaction, actn_name string, obsv *operation.Observation, rgln *operation.Operations) operation.ReactionResult {
+	after := engn.RunObservation(ctx, rctn.Observation, *obsv, rgln.Implements)
+	result.After = &after
+	if after.Succeeded == false {
+		result.Succeeded = false
+		result.Message = fmt.Sprintf(
+			"Ran '%s' but could not verify the correction, error running observation: %s",
+			actn_name,
+			after.Result,
+		)
+	} else if after.Expected == false {
+		result.Succeeded = false
+		result.Message = fmt.Sprintf(
+			"Ran '%s' but the correction did not converge, observation result was '%s' and expected '%s'",
+			actn_name,
+			after.Result,
+			obsv.Expect,
+		)
+	} else {
+		result.Message = fmt.Sprintf("Successfully ran '%s' and verified observation is now '%s'", actn_name, after.Result)
+	}
+	return result
+}
+
+func (engn *Engine) maybeRunReaction(ctx context.Context, reaction operation.Reaction, obsv *operation.Observation, obsv_result *operation.ObservationResult, rgln *operation.Operations, mode reactMode) operation.ReactionResult {
+	if obsv == nil {
+		return operation.ReactionResult{
+			Succeeded: false,
+			Skipped:   true,
+			Output:    "",
+			Logs:      "",
+			Message:   "Cannot react, '" + reaction.Observation + "' observation not found",
+			Reaction:  reaction,
+		}
+	}
+	if obsv_result.Succeeded == false {
+		return operation.ReactionResult{
+			Succeeded: false,
+			Skipped:   true,
+			Output:    obsv_result.Result,
+			Logs:      obsv_result.Logs,
+			Message:   "Cannot react, error running observation",
+			Reaction:  reaction,
+		}
+	} else {
+		var actn *operation.Action = nil
+		if reaction.Action == "correction" {
+			actn_name, actn := operparse.SelectImplementActionForCorrection(*obsv, *obsv_result, rgln.Implements)
+			if actn == nil && obsv_result.Expected == false {
+				return operation.ReactionResult{
+					Succeeded: false,
+					Skipped:   true,
+					Output:    "",
+					Logs:      "",
+					Message: fmt.Sprintf(
+						"Could not react, no correction found for Entity %s Query %s with result %s that can correct to expected result %s",
+						obsv.Entity,
+						obsv.Query,
+						obsv_result.Result,
+						obsv.Expect,
+					),
+					Reaction: reaction,
+				}
+			} else {
+				if actn != nil {
+					prepareAction(actn, obsv, mode)
+				}
+				result := engn.runReaction(
+					ctx,
+					obsv_result.Expected == false,
+					reaction,
+					actn_name,
+					actn,
+					"Skipped reaction: observation was the expected result",
+					mode,
+				)
+				if result.Skipped == false {
+					result.Before = obsv_result
+					// There's nothing to verify if the correction didn't
+					// really run
+					if result.Succeeded && mode == reactApply {
+						return engn.verifyCorrection(ctx, result, reaction, actn_name, obsv, rgln)
+					}
+				}
+				return result
+			}
+		} else {
+			actn = operparse.SelectAction(reaction.Action, rgln.Actions)
+			if actn != nil {
+				prepareAction(actn, nil, mode)
+			} else {
+				actn = operparse.SelectImplementActionByName(reaction.Action, rgln.Implements)
+				if actn != nil {
+					prepareAction(actn, obsv, mode)
+				}
+			}
+			if actn == nil {
+				return operation.ReactionResult{
+					Succeeded: false,
+					Skipped:   true,
+					Output:    "",
+					Logs:      "",
+					Message:   "Could not react, '" + reaction.Action + "' action not found",
+					Reaction:  reaction,
+				}
+			} else {
+				// Reactions with only a 'when' expression have already
+				// passed it by the time they get here
+				if reaction.Condition.Check == "" {
+					return engn.runReaction(ctx, true, reaction, reaction.Action, actn, "", mode)
+				}
+				should_run, skip_msg, rgerr := operparse.EvaluateCondition(reaction.Condition, *obsv_result)
+				if rgerr != nil {
+					return operation.ReactionResult{
+						Succeeded: false,
+						Output:    "",
+						Message:   rgerr.Message,
+						Reaction:  reaction,
+					}
+				}
+				return engn.runReaction(
+					ctx,
+					should_run,
+					reaction,
+					reaction.Action,
+					actn,
+					skip_msg,
+					mode,
+				)
+			}
+		}
+	}
+}
+
+// Reactions that only have a 'when' expression don't point at an observation,
+// so there is no observation instance to pass in to implement args
+func (engn *Engine) runUnobservedReaction(ctx context.Context, reaction operation.Reaction, rgln *operation.Operations, mode reactMode) operation.ReactionResult {
+	actn := operparse.SelectAction(reaction.Action, rgln.Actions)
+	if actn != nil {
+		prepareAction(actn, nil, mode)
+	} else {
+		actn = operparse.SelectImplementActionByName(reaction.Action, rgln.Implements)
+		if actn != nil {
+			prepareAction(actn, &operation.Observation{}, mode)
+		}
+	}
+	if actn == nil {
+		return operation.ReactionResult{
+			Succeeded: false,
+			Skipped:   true,
+			Output:    "",
+			Logs:      "",
+			Message:   "Could not react, '" + reaction.Action + "' action not found",
+			Reaction:  reaction,
+		}
+	}
+	return engn.runReaction(ctx, true, reaction, reaction.Action, actn, "", mode)
+}
+
+// Everything a 'when' expression can refer to: the spec's vars plus
+// results["name"] (the result string of an observation), observations["name"]
+// (succeeded, result, expected, and data fields of an observation result), and
+// reactions["name"] (succeeded, skipped, output and message fields of a
+// reaction result, only set for reactions that already ran)
+func buildWhenEnv(rgln *operation.Operations, obsv_results map[string]operation.ObservationResult, rctn_results map[string]operation.ReactionResult) map[string]interface{} {
+	env := make(map[string]interface{})
+	for var_name, var_value := range rgln.Vars {
+		env[var_name] = var_value
+	}
+	results := make(map[string]interface{})
+	observations := make(map[string]interface{})
+	for obsv_name, obsv_result := range obsv_results {
+		results[obsv_name] = obsv_result.Result
+		observations[obsv_name] = map[string]interface{}{
+			"succeeded": obsv_result.Succeeded,
+			"result":    obsv_result.Result,
+			"expected":  obsv_result.Expected,
+			"data":      obsv_result.Data,
+		}
+	}
+	reactions := make(map[string]interface{})
+	for rctn_name, rctn_result := range rctn_results {
+		reactions[rctn_name] = map[string]interface{}{
+			"succeeded": rctn_result.Succeeded,
+			"skipped":   rctn_result.Skipped,
+			"output":    rctn_result.Output,
+			"message":   rctn_result.Message,
+		}
+	}
+	env[operparse.WHEN_RESULTS_NAME] = results
+	env[operparse.WHEN_OBSERVATIONS_NAME] = observations
+	env[operparse.WHEN_REACTIONS_NAME] = reactions
+	return env
+}
+
+// Returns a result if the reaction's 'when' expression means it shouldn't
+// run, or nil if it should carry on
+func checkWhen(reaction operation.Reaction, rgln *operation.Operations, obsv_results map[string]operation.ObservationResult, rctn_results map[string]operation.ReactionResult) *operation.ReactionResult {
+	if reaction.When == "" {
+		return nil
+	}
+	expr, rgerr := expression.Parse(reaction.When)
+	var should_run bool
+	if rgerr == nil {
+		should_run, rgerr = expr.EvalBool(buildWhenEnv(rgln, obsv_results, rctn_results))
+	}
+	if rgerr != nil {
+		return &operation.ReactionResult{
+			Succeeded: false,
+			Skipped:   true,
+			Output:    "",
+			Logs:      "",
+			Message:   "Error checking 'when' expression: " + rgerr.Message,
+			Reaction:  reaction,
+		}
+	}
+	if !should_run {
+		return &operation.ReactionResult{
+			Succeeded: true,
+			Skipped:   true,
+			Output:    "",
+			Logs:      "",
+			Message:   "Skipped reaction: 'when' expression was false",
+			Reaction:  reaction,
+		}
+	}
+	return nil
+}
+
+// Returns the name of the first dependency of rctn that did not succeed,
+// or an empty string if all of them did. Reactions are run in dependency
+// order so every dependency already has a result by the time this is called.
+//
+// A dependency that was skipped because its condition wasn't met still
+// counts as succeeded, only real failures (including dependencies that
+// were themselves skipped because of a failure) block the reaction.
+func failedDependency(rctn operation.Reaction, rctn_results map[string]operation.ReactionResult) string {
+	for _, dep_name := range rctn.Depends_On {
+		if dep_result, found := rctn_results[dep_name]; !found || dep_result.Succeeded == false {
+			return dep_name
+		}
+	}
+	return ""
+}
+
+// Once a correction has been verified the observation's stored result is
+// replaced with the re-observed one (and the counts follow it), so 'when'
+// expressions, conditions, and corrections in later reactions see the state
+// the correction left behind rather than the state before it ran. The
+// reaction's Before and After keep both.
+func recordCorrection(results *operation.ReactionResults, obsv_name string, after operation.ObservationResult) {
+	if before, found := results.Observations[obsv_name]; found {
+		if before.Succeeded == false {
+			results.Failed_Observations--
+		}
+		if before.Expected == false {
+			results.Unexpected_Observations--
+		}
+	} else {
+		results.Total_Observations++
+	}
+	if after.Succeeded == false {
+		results.Failed_Observations++
+	}
+	if after.Expected == false {
+		results.Unexpected_Observations++
+	}
+	results.Observations[obsv_name] = after
+}
+
+func (engn *Engine) reactTo(ctx context.Context, rgln *operation.Operations, all_obsv_results operation.ObservationResults, mode reactMode) (*operation.ReactionResults, *rgerror.RGerror) {
+	// Copied so corrections don't change the caller's results
+	obsv_results := make(map[string]operation.ObservationResult, len(all_obsv_results.Observations))
+	for obsv_name, obsv_result := range all_obsv_results.Observations {
+		obsv_results[obsv_name] = obsv_result
+	}
+	results := operation.ReactionResults{
+		Dry_Run:                 mode == reactPlan,
+		Noop:                    mode == reactNoop,
+		Reactions:               make(map[string]operation.ReactionResult),
+		Observations:            obsv_results,
+		Total_Observations:      all_obsv_results.Total_Observations,
+		Failed_Observations:     all_obsv_results.Failed_Observations,
+		Unexpected_Observations: all_obsv_results.Unexpected_Observations,
+	}
+	order, rgerr := operparse.BuildReactionOrder(rgln.Reactions)
+	if rgerr != nil {
+		return nil, rgerr
+	}
+	results.Reaction_Order = order
+	for _, rctn_name := range order {
+		reaction := rgln.Reactions[rctn_name]
+		if engn.hooks.Before_Reaction != nil {
+			engn.hooks.Before_Reaction(rctn_name)
+		}
+		var this_result operation.ReactionResult
+		if failed_dep := failedDependency(reaction, results.Reactions); failed_dep != "" {
+			this_result = operation.ReactionResult{
+				Succeeded: false,
+				Skipped:   true,
+				Output:    "",
+				Logs:      "",
+				Message:   "Skipped reaction: depends on '" + failed_dep + "' which did not succeed",
+				Reaction:  reaction,
+			}
+		} else if when_result := checkWhen(reaction, rgln, obsv_results, results.Reactions); when_result != nil {
+			this_result = *when_result
+		} else if reaction.Observation == "" {
+			this_result = engn.runUnobservedReaction(ctx, reaction, rgln, mode)
+		} else {
+			obsv_name := reaction.Observation
+			obsv := operparse.SelectObservation(obsv_name, rgln.Observations)
+			obsv_result := operparse.SelectObservationResult(obsv_name, obsv_results)
+			this_result = engn.maybeRunReaction(ctx, reaction, obsv, obsv_result, rgln, mode)
+		}
+		if this_result.After != nil {
+			recordCorrection(&results, reaction.Observation, *this_result.After)
+		}
+		results.Reactions[rctn_name] = this_result
+		if engn.hooks.After_Reaction != nil {
+			engn.hooks.After_Reaction(rctn_name, this_result)
+		}
+		results.Total_Reactions++
+		if this_result.Succeeded == false {
+			results.Failed_Reactions++
+		}
+		if this_result.Skipped == true {
+			results.Skipped_Reactions++
+		}
+	}
+	return &results, nil
+}
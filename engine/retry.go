@@ -0,0 +1,51 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/puppetlabs/regulator/operation"
+	"github.com/puppetlabs/regulator/operparse"
+)
+
+// Calls attempt until it succeeds or there are no retries left, waiting
+// between attempts as the retry settings say. attempt returns whether it
+// succeeded, whether it timed out (which ends the retries unless the
+// settings say otherwise), and a summary of what happened, which is kept
+// for every failed attempt so none of them are lost from the result logs.
+//
+// Returns the number of attempts made and the summaries of the failed
+// attempts that were followed by another try. Once ctx is done there are
+// no more retries.
+func runWithRetries(ctx context.Context, retry operation.Retry, attempt func() (bool, bool, string)) (int, string) {
+	// Invalid retry settings are caught when the spec is parsed
+	delay, _ := operparse.ParseRetryDelay(retry)
+	var history []string
+	attempt_number := 1
+	for {
+		succeeded, timed_out, summary := attempt()
+		if succeeded || attempt_number > retry.Retries || ctx.Err() != nil || (timed_out && !retry.Retry_On_Timeout) {
+			return attempt_number, strings.Join(history, "\n")
+		}
+		history = append(history, fmt.Sprintf("Attempt %d of %d failed, retrying in %s: %s", attempt_number, retry.Retries+1, delay, summary))
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return attempt_number, strings.Join(history, "\n")
+		}
+		if retry.Backoff > 0 {
+			delay = time.Duration(float64(delay) * retry.Backoff)
+		}
+		attempt_number++
+	}
+}
+
+// Puts the failed attempts ahead of the logs from the final one
+func withRetryHistory(history string, logs string) string {
+	if history == "" {
+		return logs
+	}
+	return history + "\nFinal attempt: " + logs
+}
@@ -0,0 +1,105 @@
+package exitcode
+
+import (
+	"fmt"
+
+	"github.com/puppetlabs/regulator/rgerror"
+)
+
+// What regulator exits with, so CI and cron can act on results without
+// parsing the JSON:
+//
+//	0  everything went fine (or nothing went wrong enough for --fail-on)
+//	1  regulator itself failed, e.g. a spec didn't parse or ssh failed
+//	2  usage error, e.g. a missing argument or an invalid flag
+//	3  a reaction (or the action passed to run) failed
+//	4  an observation failed to run
+//	5  an observation didn't get the result it expected
+//	6  the spec failed validation
+//	7  a command regulator ran itself (not an observation or action) failed
+//	8  the remote regulator failed
+//	9  something timed out, e.g. the ssh session
+//	10 privilege escalation failed
+//
+// When more than one result code applies the lowest one wins. Remote
+// commands exit with whatever the remote regulator did, unless the
+// remote regulator couldn't be run at all.
+var OK int = 0
+var ERROR int = 1
+var USAGE int = 2
+var FAILED_REACTIONS int = 3
+var FAILED_OBSERVATIONS int = 4
+var UNEXPECTED_OBSERVATIONS int = 5
+var VALIDATION_FAILED int = 6
+var SHELL_FAILED int = 7
+var REMOTE_FAILED int = 8
+var TIMED_OUT int = 9
+var ESCALATION_FAILED int = 10
+
+// The --fail-on thresholds. With none results never change the exit code,
+// with failed (the default) only failures do, and with unexpected
+// unexpected observations do as well. Not setting it is the same as
+// failed.
+var FAIL_ON_NONE string = "none"
+var FAIL_ON_FAILED string = "failed"
+var FAIL_ON_UNEXPECTED string = "unexpected"
+
+// Whether an exit code says something about the results rather than
+// regulator failing to produce them, the results are still printed for
+// these
+func IsResultCode(code int) bool {
+	return code == FAILED_REACTIONS || code == FAILED_OBSERVATIONS || code == UNEXPECTED_OBSERVATIONS
+}
+
+// The exit code for an error, each kind has its own except exec and
+// completed errors which are just errors. Usage errors are the ones caused
+// by invalid input.
+func ForError(rgerr *rgerror.RGerror) int {
+	switch rgerr.Kind {
+	case rgerror.InvalidInput:
+		return USAGE
+	case rgerror.ValidationError:
+		return VALIDATION_FAILED
+	case rgerror.ShellError:
+		return SHELL_FAILED
+	case rgerror.RemoteExecError:
+		return REMOTE_FAILED
+	case rgerror.TimeoutError:
+		return TIMED_OUT
+	case rgerror.EscalationError:
+		return ESCALATION_FAILED
+	default:
+		return ERROR
+	}
+}
+
+func CheckFailOn(fail_on string) *rgerror.RGerror {
+	switch fail_on {
+	case "", FAIL_ON_NONE, FAIL_ON_FAILED, FAIL_ON_UNEXPECTED:
+		return nil
+	default:
+		return &rgerror.RGerror{
+			Kind: rgerror.InvalidInput,
+			Message: fmt.Sprintf("Invalid --fail-on '%s', must be one of '%s', '%s', or '%s'",
+				fail_on, FAIL_ON_NONE, FAIL_ON_FAILED, FAIL_ON_UNEXPECTED),
+			Origin: nil,
+		}
+	}
+}
+
+// The exit code for a set of results
+func ForResults(failed_reactions int, failed_observations int, unexpected_observations int, fail_on string) int {
+	if fail_on == FAIL_ON_NONE {
+		return OK
+	}
+	if failed_reactions > 0 {
+		return FAILED_REACTIONS
+	}
+	if failed_observations > 0 {
+		return FAILED_OBSERVATIONS
+	}
+	if fail_on == FAIL_ON_UNEXPECTED && unexpected_observations > 0 {
+		return UNEXPECTED_OBSERVATIONS
+	}
+	return OK
+}
@@ -0,0 +1,400 @@
+package expression
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/puppetlabs/regulator/rgerror"
+)
+
+// A small expression language used for reaction 'when' clauses, things like:
+//
+// results["running count"] > 3 && facts.os == "linux"
+//
+// Supports number, string, true/false/null literals, names looked up in
+// an environment, field access with '.' or '[...]', the usual arithmetic,
+// comparison and boolean operators, and parentheses.
+//
+// Values are loosely typed on purpose: observation results are always
+// strings, so comparing a string that looks like a number with a number
+// compares them numerically.
+type Expression struct {
+	Source string
+	root   node
+}
+
+func Parse(src string) (*Expression, *rgerror.RGerror) {
+	root, err := parse(src)
+	if err != nil {
+		return nil, &rgerror.RGerror{
+			Kind:    rgerror.InvalidInput,
+			Message: fmt.Sprintf("Failed to parse expression '%s': %s", src, err),
+			Origin:  err,
+		}
+	}
+	return &Expression{Source: src, root: root}, nil
+}
+
+func (expr *Expression) Eval(env map[string]interface{}) (interface{}, *rgerror.RGerror) {
+	value, err := eval(expr.root, env)
+	if err != nil {
+		return nil, &rgerror.RGerror{
+			Kind:    rgerror.InvalidInput,
+			Message: fmt.Sprintf("Failed to evaluate expression '%s': %s", expr.Source, err),
+			Origin:  err,
+		}
+	}
+	return value, nil
+}
+
+func (expr *Expression) EvalBool(env map[string]interface{}) (bool, *rgerror.RGerror) {
+	value, rgerr := expr.Eval(env)
+	if rgerr != nil {
+		return false, rgerr
+	}
+	return Truthy(value), nil
+}
+
+// null, false, 0 and "" are false, everything else is true
+func Truthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	default:
+		return true
+	}
+}
+
+// Normalizes values coming from the environment (which are often
+// straight out of yaml) so eval only has to deal with float64 numbers
+func normalize(value interface{}) interface{} {
+	switch v := value.(type) {
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case float32:
+		return float64(v)
+	default:
+		return value
+	}
+}
+
+func asNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case string:
+		number, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return number, err == nil
+	default:
+		return 0, false
+	}
+}
+
+func lookup(object interface{}, key interface{}) (interface{}, error) {
+	switch obj := object.(type) {
+	case nil:
+		// Looking up a field on a missing value is just another missing
+		// value, so things like reactions["not run yet"].succeeded are safe
+		return nil, nil
+	case map[string]interface{}:
+		return normalize(obj[fmt.Sprint(key)]), nil
+	case map[interface{}]interface{}:
+		return normalize(obj[fmt.Sprint(key)]), nil
+	case []interface{}:
+		index, ok := key.(float64)
+		if !ok || index != math.Trunc(index) {
+			return nil, fmt.Errorf("list index must be a whole number, given '%v'", key)
+		}
+		if index < 0 || int(index) >= len(obj) {
+			return nil, nil
+		}
+		return normalize(obj[int(index)]), nil
+	default:
+		return nil, fmt.Errorf("cannot look up '%v' on %v", key, object)
+	}
+}
+
+// Maps and lists are equal when everything in them is, using the same
+// rules as for single values, so maps from a spec's vars and from JSON
+// output can be compared with each other
+func equal(left interface{}, right interface{}) bool {
+	left = normalize(left)
+	right = normalize(right)
+	left_map, left_is_map := asMap(left)
+	right_map, right_is_map := asMap(right)
+	if left_is_map || right_is_map {
+		if !left_is_map || !right_is_map || len(left_map) != len(right_map) {
+			return false
+		}
+		for key, left_value := range left_map {
+			right_value, found := right_map[key]
+			if !found || !equal(left_value, right_value) {
+				return false
+			}
+		}
+		return true
+	}
+	left_list, left_is_list := left.([]interface{})
+	right_list, right_is_list := right.([]interface{})
+	if left_is_list || right_is_list {
+		if !left_is_list || !right_is_list || len(left_list) != len(right_list) {
+			return false
+		}
+		for index := range left_list {
+			if !equal(left_list[index], right_list[index]) {
+				return false
+			}
+		}
+		return true
+	}
+	_, left_is_number := left.(float64)
+	_, right_is_number := right.(float64)
+	if left_is_number || right_is_number {
+		left_number, left_ok := asNumber(left)
+		right_number, right_ok := asNumber(right)
+		if left_ok && right_ok {
+			return left_number == right_number
+		}
+		return false
+	}
+	switch left.(type) {
+	case nil, bool, string, float64:
+		return left == right
+	default:
+		// Anything else (which specs can't really produce) might not be
+		// comparable with ==
+		return false
+	}
+}
+
+// Both kinds of map keyed by their keys as strings, the way lookup finds
+// them
+func asMap(value interface{}) (map[string]interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v, true
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			converted[fmt.Sprint(key)] = item
+		}
+		return converted, true
+	default:
+		return nil, false
+	}
+}
+
+func compare(operator string, left interface{}, right interface{}) (bool, error) {
+	var order int
+	left_number, left_ok := asNumber(left)
+	right_number, right_ok := asNumber(right)
+	left_string, left_is_string := left.(string)
+	right_string, right_is_string := right.(string)
+	if left_ok && right_ok {
+		if left_number < right_number {
+			order = -1
+		} else if left_number > right_number {
+			order = 1
+		}
+	} else if left_is_string && right_is_string {
+		order = strings.Compare(left_string, right_string)
+	} else {
+		return false, fmt.Errorf("cannot compare '%v' %s '%v'", left, operator, right)
+	}
+	switch operator {
+	case "<":
+		return order < 0, nil
+	case "<=":
+		return order <= 0, nil
+	case ">":
+		return order > 0, nil
+	default:
+		return order >= 0, nil
+	}
+}
+
+func arithmetic(operator string, left interface{}, right interface{}) (interface{}, error) {
+	if operator == "+" {
+		// Adding anything to a string that isn't a number concatenates
+		_, left_ok := left.(float64)
+		_, right_ok := right.(float64)
+		if !left_ok || !right_ok {
+			left_string, left_is_string := left.(string)
+			right_string, right_is_string := right.(string)
+			if left_is_string || right_is_string {
+				if !left_is_string {
+					left_string = fmt.Sprint(left)
+				}
+				if !right_is_string {
+					right_string = fmt.Sprint(right)
+				}
+				return left_string + right_string, nil
+			}
+		}
+	}
+	left_number, left_ok := asNumber(left)
+	right_number, right_ok := asNumber(right)
+	if !left_ok || !right_ok {
+		return nil, fmt.Errorf("cannot apply '%s' to '%v' and '%v'", operator, left, right)
+	}
+	switch operator {
+	case "+":
+		return left_number + right_number, nil
+	case "-":
+		return left_number - right_number, nil
+	case "*":
+		return left_number * right_number, nil
+	case "/":
+		if right_number == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return left_number / right_number, nil
+	default:
+		if right_number == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return math.Mod(left_number, right_number), nil
+	}
+}
+
+func eval(n node, env map[string]interface{}) (interface{}, error) {
+	switch current := n.(type) {
+	case literalNode:
+		return current.value, nil
+	case identNode:
+		value, found := env[current.name]
+		if !found {
+			return nil, fmt.Errorf("unknown name '%s'", current.name)
+		}
+		return normalize(value), nil
+	case memberNode:
+		object, err := eval(current.object, env)
+		if err != nil {
+			return nil, err
+		}
+		return lookup(object, current.name)
+	case indexNode:
+		object, err := eval(current.object, env)
+		if err != nil {
+			return nil, err
+		}
+		index, err := eval(current.index, env)
+		if err != nil {
+			return nil, err
+		}
+		return lookup(object, index)
+	case unaryNode:
+		operand, err := eval(current.operand, env)
+		if err != nil {
+			return nil, err
+		}
+		if current.operator == "!" {
+			return !Truthy(operand), nil
+		}
+		number, ok := asNumber(operand)
+		if !ok {
+			return nil, fmt.Errorf("cannot negate '%v'", operand)
+		}
+		return -number, nil
+	case binaryNode:
+		left, err := eval(current.left, env)
+		if err != nil {
+			return nil, err
+		}
+		// Boolean operators short circuit
+		switch current.operator {
+		case "&&":
+			if !Truthy(left) {
+				return false, nil
+			}
+			right, err := eval(current.right, env)
+			if err != nil {
+				return nil, err
+			}
+			return Truthy(right), nil
+		case "||":
+			if Truthy(left) {
+				return true, nil
+			}
+			right, err := eval(current.right, env)
+			if err != nil {
+				return nil, err
+			}
+			return Truthy(right), nil
+		}
+		right, err := eval(current.right, env)
+		if err != nil {
+			return nil, err
+		}
+		switch current.operator {
+		case "==":
+			return equal(left, right), nil
+		case "!=":
+			return !equal(left, right), nil
+		case "<", "<=", ">", ">=":
+			return compare(current.operator, left, right)
+		default:
+			return arithmetic(current.operator, left, right)
+		}
+	}
+	return nil, fmt.Errorf("unknown expression node %T", n)
+}
+
+// The keys an expression looks up on the name object_name, e.g. for
+// results["a"] && results.b it's "a" and "b". If object_name is used in a
+// way the keys can't be known without evaluating (results[x], or results on
+// its own) all is true.
+func (expr *Expression) Keys(object_name string) (keys []string, all bool) {
+	seen := make(map[string]bool)
+	var walk func(n node)
+	walk = func(n node) {
+		switch current := n.(type) {
+		case identNode:
+			if current.name == object_name {
+				all = true
+			}
+		case memberNode:
+			if ident, ok := current.object.(identNode); ok && ident.name == object_name {
+				if !seen[current.name] {
+					seen[current.name] = true
+					keys = append(keys, current.name)
+				}
+				return
+			}
+			walk(current.object)
+		case indexNode:
+			if ident, ok := current.object.(identNode); ok && ident.name == object_name {
+				literal, is_literal := current.index.(literalNode)
+				key, is_string := literal.value.(string)
+				if is_literal && is_string {
+					if !seen[key] {
+						seen[key] = true
+						keys = append(keys, key)
+					}
+				} else {
+					all = true
+				}
+			} else {
+				walk(current.object)
+			}
+			walk(current.index)
+		case unaryNode:
+			walk(current.operand)
+		case binaryNode:
+			walk(current.left)
+			walk(current.right)
+		}
+	}
+	walk(expr.root)
+	return keys, all
+}
@@ -0,0 +1,227 @@
+package expression
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func testEnv() map[string]interface{} {
+	return map[string]interface{}{
+		"count": 3,
+		"name":  "web",
+		"results": map[string]interface{}{
+			"running count": "4",
+			"status":        "RUNNING",
+		},
+		"facts": map[interface{}]interface{}{
+			"os":    "linux",
+			"cores": 8,
+		},
+		"disks": []interface{}{"sda", "sdb"},
+		"empty": "",
+	}
+}
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want interface{}
+	}{
+		{"multiplication before addition", "1 + 2 * 3", 7.0},
+		{"parentheses first", "(1 + 2) * 3", 9.0},
+		{"left associative subtraction", "10 - 4 - 3", 3.0},
+		{"left associative division", "12 / 3 / 2", 2.0},
+		{"modulo", "7 % 4", 3.0},
+		{"unary minus", "-2 * 3", -6.0},
+		{"double negation", "!!1", true},
+		{"comparison before equality", "1 < 2 == true", true},
+		{"and before or", "true || false && false", true},
+		{"or with parentheses", "(true || false) && false", false},
+		{"arithmetic before comparison", "1 + 1 > 1", true},
+		{"string number compared numerically", `results["running count"] > 3`, true},
+		{"string number equals number", `results["running count"] == 4`, true},
+		{"string comparison", `"abc" < "abd"`, true},
+		{"string concatenation", `name + "-1"`, "web-1"},
+		{"concatenation with number", `"n" + 1`, "n1"},
+		{"member access", "facts.os", "linux"},
+		{"index access", `facts["cores"]`, 8.0},
+		{"list index", "disks[1]", "sdb"},
+		{"env ints are numbers", "count * 2", 6.0},
+		{"missing key is null", "results.missing", nil},
+		{"field of missing key is null", "results.missing.deeper", nil},
+		{"out of range index is null", "disks[5]", nil},
+		{"null equals missing", "results.missing == null", true},
+		{"not equal", `name != "db"`, true},
+		{"literals", "true && !false", true},
+		{"escaped quote in string", `"it\"s"`, `it"s`},
+		{"single quoted string", `'web' == name`, true},
+		{"short circuit and", "false && unknown_name", false},
+		{"short circuit or", "true || unknown_name", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expr, rgerr := Parse(test.src)
+			if rgerr != nil {
+				t.Fatalf("Parse(%q) failed: %s", test.src, rgerr.Message)
+			}
+			got, rgerr := expr.Eval(testEnv())
+			if rgerr != nil {
+				t.Fatalf("Eval(%q) failed: %s", test.src, rgerr.Message)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Eval(%q) = %#v, want %#v", test.src, got, test.want)
+			}
+		})
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+	}{
+		{"unknown name", "nope == 1"},
+		{"compare string with number", `name > 1`},
+		{"compare bool with number", "true < 1"},
+		{"subtract strings", `name - "b"`},
+		{"negate a string", "-name"},
+		{"division by zero", "1 / 0"},
+		{"modulo by zero", "1 % 0"},
+		{"member access on a string", "name.length"},
+		{"fractional list index", "disks[0.5]"},
+		{"string list index", `disks["0"]`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expr, rgerr := Parse(test.src)
+			if rgerr != nil {
+				t.Fatalf("Parse(%q) failed: %s", test.src, rgerr.Message)
+			}
+			got, rgerr := expr.Eval(testEnv())
+			if rgerr == nil {
+				t.Fatalf("Eval(%q) = %#v, want an error", test.src, got)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []string{
+		"",
+		"   ",
+		"1 +",
+		"(1 + 2",
+		"1 + 2)",
+		"results[",
+		`results["a"`,
+		"facts.",
+		"facts.1",
+		`"unterminated`,
+		"'unterminated",
+		`"trailing backslash\`,
+		"1..2",
+		"1 2",
+		"a b",
+		"&& true",
+		"!",
+		"a = b",
+		"a & b",
+		"a | b",
+		"#",
+		"[]",
+		"()",
+		"1 == == 2",
+	}
+	for _, src := range tests {
+		t.Run(src, func(t *testing.T) {
+			expr, rgerr := Parse(src)
+			if rgerr == nil {
+				t.Fatalf("Parse(%q) = %#v, want an error", src, expr)
+			}
+		})
+	}
+}
+
+func TestEvalBool(t *testing.T) {
+	tests := []struct {
+		src  string
+		want bool
+	}{
+		{"empty", false},
+		{"name", true},
+		{"0", false},
+		{"count", true},
+		{"results.missing", false},
+		{"disks", true},
+	}
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			expr, rgerr := Parse(test.src)
+			if rgerr != nil {
+				t.Fatalf("Parse(%q) failed: %s", test.src, rgerr.Message)
+			}
+			got, rgerr := expr.EvalBool(testEnv())
+			if rgerr != nil {
+				t.Fatalf("EvalBool(%q) failed: %s", test.src, rgerr.Message)
+			}
+			if got != test.want {
+				t.Errorf("EvalBool(%q) = %t, want %t", test.src, got, test.want)
+			}
+		})
+	}
+}
+
+func TestEqual(t *testing.T) {
+	tests := []struct {
+		name  string
+		left  interface{}
+		right interface{}
+		want  bool
+	}{
+		{"maps of both kinds", map[string]interface{}{"a": 1}, map[interface{}]interface{}{"a": 1.0}, true},
+		{"maps with different values", map[string]interface{}{"a": 1}, map[string]interface{}{"a": 2}, false},
+		{"map and list", map[string]interface{}{}, []interface{}{}, false},
+		{"nested lists", []interface{}{[]interface{}{"1"}}, []interface{}{[]interface{}{1}}, true},
+		{"lists of different lengths", []interface{}{1}, []interface{}{1, 2}, false},
+		{"uncomparable values", []string{"a"}, []string{"a"}, false},
+		{"number and non numeric string", 1.0, "one", false},
+		{"null and false", nil, false, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := equal(test.left, test.right); got != test.want {
+				t.Errorf("equal(%#v, %#v) = %t, want %t", test.left, test.right, got, test.want)
+			}
+		})
+	}
+}
+
+func TestKeys(t *testing.T) {
+	tests := []struct {
+		src       string
+		want_keys []string
+		want_all  bool
+	}{
+		{`results["a"] && results.b`, []string{"a", "b"}, false},
+		{`results["a"] == results["a"]`, []string{"a"}, false},
+		{`observations.a.succeeded`, nil, false},
+		{`results[name]`, nil, true},
+		{`results`, nil, true},
+		{`facts[results.c]`, []string{"c"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			expr, rgerr := Parse(test.src)
+			if rgerr != nil {
+				t.Fatalf("Parse(%q) failed: %s", test.src, rgerr.Message)
+			}
+			keys, all := expr.Keys("results")
+			sort.Strings(keys)
+			if !reflect.DeepEqual(keys, test.want_keys) || all != test.want_all {
+				t.Errorf("Keys(%q) = %v, %t, want %v, %t", test.src, keys, all, test.want_keys, test.want_all)
+			}
+		})
+	}
+}
@@ -0,0 +1,98 @@
+package expression
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenIdent
+	tokenOperator
+)
+
+type token struct {
+	kind   tokenKind
+	text   string
+	number float64
+	// Offset in the source string, used for error messages
+	pos int
+}
+
+// Operators are matched longest first so that "<=" isn't read as "<" "="
+var operators = []string{
+	"&&", "||", "==", "!=", "<=", ">=",
+	"<", ">", "!", "+", "-", "*", "/", "%", "(", ")", "[", "]", ".",
+}
+
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	pos := 0
+	for pos < len(src) {
+		char := rune(src[pos])
+		switch {
+		case unicode.IsSpace(char):
+			pos++
+		case unicode.IsDigit(char):
+			start := pos
+			for pos < len(src) && (unicode.IsDigit(rune(src[pos])) || src[pos] == '.') {
+				pos++
+			}
+			number, err := strconv.ParseFloat(src[start:pos], 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number '%s' at position %d", src[start:pos], start)
+			}
+			tokens = append(tokens, token{kind: tokenNumber, text: src[start:pos], number: number, pos: start})
+		case char == '"' || char == '\'':
+			start := pos
+			pos++
+			var builder strings.Builder
+			closed := false
+			for pos < len(src) {
+				if src[pos] == '\\' && pos+1 < len(src) {
+					builder.WriteByte(src[pos+1])
+					pos += 2
+					continue
+				}
+				if rune(src[pos]) == char {
+					closed = true
+					pos++
+					break
+				}
+				builder.WriteByte(src[pos])
+				pos++
+			}
+			if !closed {
+				return nil, fmt.Errorf("unterminated string starting at position %d", start)
+			}
+			tokens = append(tokens, token{kind: tokenString, text: builder.String(), pos: start})
+		case unicode.IsLetter(char) || char == '_':
+			start := pos
+			for pos < len(src) && (unicode.IsLetter(rune(src[pos])) || unicode.IsDigit(rune(src[pos])) || src[pos] == '_') {
+				pos++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, text: src[start:pos], pos: start})
+		default:
+			matched := false
+			for _, operator := range operators {
+				if strings.HasPrefix(src[pos:], operator) {
+					tokens = append(tokens, token{kind: tokenOperator, text: operator, pos: pos})
+					pos += len(operator)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("unexpected character '%c' at position %d", char, pos)
+			}
+		}
+	}
+	tokens = append(tokens, token{kind: tokenEOF, pos: len(src)})
+	return tokens, nil
+}
@@ -0,0 +1,195 @@
+package expression
+
+import (
+	"fmt"
+)
+
+type node interface{}
+
+type literalNode struct {
+	value interface{}
+}
+
+type identNode struct {
+	name string
+}
+
+type memberNode struct {
+	object node
+	name   string
+}
+
+type indexNode struct {
+	object node
+	index  node
+}
+
+type unaryNode struct {
+	operator string
+	operand  node
+}
+
+type binaryNode struct {
+	operator string
+	left     node
+	right    node
+}
+
+// Binding power of each binary operator, higher binds tighter
+var precedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"==": 3, "!=": 3,
+	"<": 4, "<=": 4, ">": 4, ">=": 4,
+	"+": 5, "-": 5,
+	"*": 6, "/": 6, "%": 6,
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) expect(operator string) error {
+	tok := p.next()
+	if tok.kind != tokenOperator || tok.text != operator {
+		return unexpected(tok, "'"+operator+"'")
+	}
+	return nil
+}
+
+func unexpected(tok token, wanted string) error {
+	if tok.kind == tokenEOF {
+		return fmt.Errorf("unexpected end of expression, expected %s", wanted)
+	}
+	return fmt.Errorf("unexpected '%s' at position %d, expected %s", tok.text, tok.pos, wanted)
+}
+
+func parse(src string) (node, error) {
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parseBinary(1)
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, unexpected(tok, "an operator")
+	}
+	return root, nil
+}
+
+// Precedence climbing: parse everything that binds at least as tightly
+// as min_precedence, then fold in operators from left to right
+func (p *parser) parseBinary(min_precedence int) (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		op_precedence, is_binary := precedence[tok.text]
+		if tok.kind != tokenOperator || !is_binary || op_precedence < min_precedence {
+			return left, nil
+		}
+		p.next()
+		right, err := p.parseBinary(op_precedence + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{operator: tok.text, left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (node, error) {
+	tok := p.peek()
+	if tok.kind == tokenOperator && (tok.text == "!" || tok.text == "-") {
+		p.next()
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return unaryNode{operator: tok.text, operand: operand}, nil
+	}
+	return p.parsePostfix()
+}
+
+func (p *parser) parsePostfix() (node, error) {
+	current, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		tok := p.peek()
+		if tok.kind != tokenOperator {
+			return current, nil
+		}
+		switch tok.text {
+		case ".":
+			p.next()
+			name := p.next()
+			if name.kind != tokenIdent {
+				return nil, unexpected(name, "a field name")
+			}
+			current = memberNode{object: current, name: name.text}
+		case "[":
+			p.next()
+			index, err := p.parseBinary(1)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+			current = indexNode{object: current, index: index}
+		default:
+			return current, nil
+		}
+	}
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokenNumber:
+		return literalNode{value: tok.number}, nil
+	case tokenString:
+		return literalNode{value: tok.text}, nil
+	case tokenIdent:
+		switch tok.text {
+		case "true":
+			return literalNode{value: true}, nil
+		case "false":
+			return literalNode{value: false}, nil
+		case "null":
+			return literalNode{value: nil}, nil
+		}
+		return identNode{name: tok.text}, nil
+	case tokenOperator:
+		if tok.text == "(" {
+			inner, err := p.parseBinary(1)
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			return inner, nil
+		}
+	}
+	return nil, unexpected(tok, "a value")
+}
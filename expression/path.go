@@ -0,0 +1,88 @@
+package expression
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/puppetlabs/regulator/rgerror"
+)
+
+// A JSONPath style selector for picking a value out of structured data,
+// things like:
+//
+// .instances[0].status
+// $.instances[0]["network interfaces"]
+//
+// Only field access and list indexes are supported, there are no
+// wildcards or filters.
+type Path struct {
+	Source string
+	keys   []interface{}
+}
+
+func ParsePath(src string) (*Path, *rgerror.RGerror) {
+	fail := func(err error) (*Path, *rgerror.RGerror) {
+		return nil, &rgerror.RGerror{
+			Kind:    rgerror.InvalidInput,
+			Message: fmt.Sprintf("Failed to parse path '%s': %s", src, err),
+			Origin:  err,
+		}
+	}
+	// The leading $ is optional, it's only allowed so that paths copied
+	// from other JSONPath tools work as-is
+	trimmed := strings.TrimPrefix(strings.TrimSpace(src), "$")
+	tokens, err := tokenize(trimmed)
+	if err != nil {
+		return fail(err)
+	}
+	path := &Path{Source: src}
+	p := &parser{tokens: tokens}
+	for p.peek().kind != tokenEOF {
+		tok := p.next()
+		if tok.kind != tokenOperator {
+			return fail(unexpected(tok, "'.' or '['"))
+		}
+		switch tok.text {
+		case ".":
+			name := p.next()
+			if name.kind != tokenIdent {
+				return fail(unexpected(name, "a field name"))
+			}
+			path.keys = append(path.keys, name.text)
+		case "[":
+			key := p.next()
+			switch key.kind {
+			case tokenNumber:
+				path.keys = append(path.keys, key.number)
+			case tokenString:
+				path.keys = append(path.keys, key.text)
+			default:
+				return fail(unexpected(key, "a list index or quoted field name"))
+			}
+			if err := p.expect("]"); err != nil {
+				return fail(err)
+			}
+		default:
+			return fail(unexpected(tok, "'.' or '['"))
+		}
+	}
+	return path, nil
+}
+
+// Missing fields and out of range indexes select null rather than failing,
+// the same way they do in expressions
+func (path *Path) Select(data interface{}) (interface{}, *rgerror.RGerror) {
+	current := normalize(data)
+	for _, key := range path.keys {
+		next, err := lookup(current, key)
+		if err != nil {
+			return nil, &rgerror.RGerror{
+				Kind:    rgerror.InvalidInput,
+				Message: fmt.Sprintf("Failed to select path '%s': %s", path.Source, err),
+				Origin:  err,
+			}
+		}
+		current = next
+	}
+	return current, nil
+}
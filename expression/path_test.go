@@ -0,0 +1,91 @@
+package expression
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPathSelect(t *testing.T) {
+	data := map[string]interface{}{
+		"instances": []interface{}{
+			map[string]interface{}{
+				"status":             "RUNNING",
+				"network interfaces": []interface{}{"nic0"},
+				"cpus":               2,
+			},
+		},
+	}
+	tests := []struct {
+		src  string
+		want interface{}
+	}{
+		{".instances[0].status", "RUNNING"},
+		{"$.instances[0].status", "RUNNING"},
+		{`$.instances[0]["network interfaces"][0]`, "nic0"},
+		{".instances[0].cpus", 2.0},
+		{".instances[3].status", nil},
+		{".missing.deeper", nil},
+		{"", data},
+		{"$", data},
+	}
+	for _, test := range tests {
+		t.Run(test.src, func(t *testing.T) {
+			path, rgerr := ParsePath(test.src)
+			if rgerr != nil {
+				t.Fatalf("ParsePath(%q) failed: %s", test.src, rgerr.Message)
+			}
+			got, rgerr := path.Select(data)
+			if rgerr != nil {
+				t.Fatalf("Select(%q) failed: %s", test.src, rgerr.Message)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("Select(%q) = %#v, want %#v", test.src, got, test.want)
+			}
+		})
+	}
+}
+
+func TestPathSelectErrors(t *testing.T) {
+	data := map[string]interface{}{"status": "RUNNING", "list": []interface{}{1}}
+	tests := []string{
+		".status.field",
+		`.list["0"]`,
+		".list[0.5]",
+	}
+	for _, src := range tests {
+		t.Run(src, func(t *testing.T) {
+			path, rgerr := ParsePath(src)
+			if rgerr != nil {
+				t.Fatalf("ParsePath(%q) failed: %s", src, rgerr.Message)
+			}
+			got, rgerr := path.Select(data)
+			if rgerr == nil {
+				t.Fatalf("Select(%q) = %#v, want an error", src, got)
+			}
+		})
+	}
+}
+
+func TestParsePathErrors(t *testing.T) {
+	tests := []string{
+		"status",
+		".",
+		".[0]",
+		"[",
+		"[0",
+		"[a]",
+		"[true]",
+		`["unterminated`,
+		".a..b",
+		".a + .b",
+		"$$.a",
+	}
+	for _, src := range tests {
+		t.Run(src, func(t *testing.T) {
+			path, rgerr := ParsePath(src)
+			if rgerr == nil {
+				t.Fatalf("ParsePath(%q) = %#v, want an error", src, path)
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ go 1.18
 require (
 	golang.org/x/crypto v0.0.0-20220507011949-2cf3adece122
 	gopkg.in/yaml.v2 v2.4.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require golang.org/x/sys v0.0.0-20210615035016-665e8c7367d1 // indirect
@@ -9,6 +9,7 @@ import (
 
 	"github.com/puppetlabs/regulator/cli"
 	"github.com/puppetlabs/regulator/localexec"
+	"github.com/puppetlabs/regulator/render"
 	"github.com/puppetlabs/regulator/rgerror"
 )
 
@@ -54,6 +55,23 @@ func readInstanceNames(state string, gcloud_project string) *rgerror.RGerror {
 	return nil
 }
 
+// Prints every instance as JSON so one observation can return all of
+// them, for use with 'output: json' and expect_path in observations
+func readAllInstances(gcloud_project string) *rgerror.RGerror {
+	instance_data, rgerr := runGcloudInstanceList(gcloud_project)
+	if rgerr != nil {
+		return rgerr
+	}
+	output := make(map[string]interface{})
+	output["instances"] = instance_data
+	final_result, rgerr := render.RenderJson(output)
+	if rgerr != nil {
+		return rgerr
+	}
+	fmt.Printf("%s", final_result)
+	return nil
+}
+
 func main() {
 	command_list := []cli.Command{
 		{
@@ -72,6 +90,22 @@ func main() {
 				os.Exit(0)
 			},
 		},
+		{
+			Verb: "get",
+			Noun: "instances",
+			ExecutionFn: func() {
+				usage := "gcloud_compute_impl get instances [GCLOUD_PROJECT]"
+				description := "return all instances and their data as JSON"
+				cli.ShouldHaveArgs(3, usage, description, nil)
+				cli.HandleCommandRGerror(
+					readAllInstances(os.Args[3]),
+					usage,
+					description,
+					nil,
+				)
+				os.Exit(0)
+			},
+		},
 		{
 			Verb: "list",
 			Noun: "instances",
@@ -72,10 +72,10 @@ def setup(noop)
   case noop.strip
   when "run"
     Puppet[:noop] = false
-  when "observe"
+  when "observe", "noop"
     Puppet[:noop] = true
   else
-    $stderr.puts "ERROR: first argument must match 'run' or 'observe', given #{noop.strip}. Cannot continue"
+    $stderr.puts "ERROR: first argument must match 'run', 'observe', or 'noop', given #{noop.strip}. Cannot continue"
     $stdout.puts "failures"
     exit 1
   end
@@ -115,17 +115,33 @@ def format_report_to_result(raw_report)
     end
     if resource_result[2] != 0 && failed_results.include?(resource_result[0])
       # Failures are the
-      result = "failures"
-      $stdout.puts result
-      return
+      return "failures"
     end
   end
-  $stdout.puts result
+  result
+end
+
+# Regulator's noop protocol: say whether a real run would change anything
+def print_noop_result(result)
+  case result
+  when "changes"
+    $stdout.puts "would_change"
+  when "conformed"
+    $stdout.puts "no_change"
+  else
+    $stderr.puts "ERROR: noop run of the code found failures, cannot tell what a real run would change"
+    $stdout.puts result
+    exit 1
+  end
 end
 
 begin
+  mode = ARGV[0].to_s.strip
+  # Regulator also asks for noop through the environment, which has to win
+  # over the args so a real run can never happen when noop was asked for
+  mode = "noop" if mode == "run" && ENV['REGULATOR_NOOP'] == "true"
   puppet_code = ARGV[1]
-  puppet_root = setup(ARGV[0])
+  puppet_root = setup(mode)
 
   env = Puppet.lookup(:environments).get('production')
   # Needed to ensure features are loaded
@@ -159,7 +175,12 @@ begin
     configurer = Puppet::Configurer.new
     configurer.run(catalog: catalog, report: report, pluginsync: false)
   end
-  format_report_to_result(report)
+  result = format_report_to_result(report)
+  if mode == "noop"
+    print_noop_result(result)
+  else
+    $stdout.puts result
+  end
 ensure
   begin
     FileUtils.remove_dir(puppet_root)
@@ -1,10 +1,10 @@
 package local
 
 import (
+	"context"
 	"fmt"
 
-	"github.com/puppetlabs/regulator/localexec"
-	"github.com/puppetlabs/regulator/localfile"
+	"github.com/puppetlabs/regulator/exitcode"
 	"github.com/puppetlabs/regulator/operation"
 	"github.com/puppetlabs/regulator/operparse"
 	"github.com/puppetlabs/regulator/render"
@@ -12,28 +12,16 @@ import (
 	"github.com/puppetlabs/regulator/validator"
 )
 
+// Deprecated: use engine.Engine.RunPreparedAction, this runs the action
+// (never in noop mode) with a default engine
 func RunAction(actn operation.Action) operation.ActionResult {
-	result := operation.ActionResult{
-		Action: actn,
-	}
-	output, logs, cmd_rgerr := localexec.BuildAndRunCommand(actn.Exe, actn.Path, actn.Script, actn.Args)
-	if cmd_rgerr != nil {
-		result.Succeeded = false
-		result.Output = output
-		result.Logs = fmt.Sprintf("Error: %s, Logs: %s", cmd_rgerr.Message, logs)
-	} else {
-		result.Succeeded = true
-		result.Output = output
-		result.Logs = logs
-	}
-	return result
+	return newEngine(RunOptions{}).RunPreparedAction(context.Background(), "", actn, false)
 }
 
 func Run(raw_data []byte, actn_name string) (string, *rgerror.RGerror) {
-	rgerr := validator.ValidateParams(fmt.Sprintf(
-		`[{"name":"action name","value":"%s","validate":["NotEmpty"]}]`,
-		actn_name,
-	))
+	rgerr := validator.Validate(
+		validator.Param{Name: "action name", Value: actn_name, Rules: []validator.Rule{validator.NotEmpty}},
+	)
 	if rgerr != nil {
 		return "", rgerr
 	}
@@ -42,19 +30,14 @@ func Run(raw_data []byte, actn_name string) (string, *rgerror.RGerror) {
 	if parse_rgerr != nil {
 		return "", parse_rgerr
 	}
-	actn := operparse.SelectAction(actn_name, data.Actions)
-	if actn == nil {
-		return "", &rgerror.RGerror{
-			Kind:    rgerror.InvalidInput,
-			Message: fmt.Sprintf("Name \"%s\" does not match any existing action names", actn_name),
-			Origin:  nil,
-		}
+	return RunOperations(&data, actn_name)
+}
+
+func RunOperations(data *operation.Operations, actn_name string) (string, *rgerror.RGerror) {
+	raw_final_result, rgerr := newEngine(RunOptions{}).RunAction(context.Background(), data, actn_name)
+	if rgerr != nil {
+		return "", rgerr
 	}
-	result := RunAction(*actn)
-	raw_final_result := operation.ActionResults{Actions: make(map[string]operation.ActionResult)}
-	raw_final_result.Actions[actn_name] = result
-	// The result for actions (for now) is an actionresults set with one action
-	// result in the actions field.
 	final_result, parse_rgerr := render.RenderJson(raw_final_result)
 	if parse_rgerr != nil {
 		return "", parse_rgerr
@@ -62,16 +45,37 @@ func Run(raw_data []byte, actn_name string) (string, *rgerror.RGerror) {
 	return final_result, nil
 }
 
-func CLIRun(maybe_file string, actn_name string) *rgerror.RGerror {
-	// ReadFileOrStdin performs validation on maybe_file
-	raw_data, rgerr := localfile.ReadFileOrStdin(maybe_file)
+// Returns the exit code for the results, see the exitcode package. A failed
+// action counts as a failed reaction.
+func CLIRun(spec_sources []string, actn_name string, opts RunOptions) (int, *rgerror.RGerror) {
+	renderer, rgerr := checkRunOptions(opts)
 	if rgerr != nil {
-		return rgerr
+		return exitcode.ForError(rgerr), rgerr
 	}
-	result, rgerr := Run(raw_data, actn_name)
+	data, rgerr := loadSpecs(spec_sources, opts, false)
 	if rgerr != nil {
-		return rgerr
+		return exitcode.ForError(rgerr), rgerr
+	}
+	rgerr = operparse.CheckActionSelected(actn_name, data, opts.Selector)
+	if rgerr != nil {
+		return exitcode.ForError(rgerr), rgerr
+	}
+	ctx, stop := interruptContext()
+	results, rgerr := newEngine(opts).RunAction(ctx, data, actn_name)
+	stop()
+	if rgerr != nil {
+		return exitcode.ForError(rgerr), rgerr
+	}
+	final_result, rgerr := renderer.RenderActions(results)
+	if rgerr != nil {
+		return exitcode.ForError(rgerr), rgerr
+	}
+	fmt.Print(final_result)
+	failed_actions := 0
+	for _, result := range results.Actions {
+		if !result.Succeeded {
+			failed_actions++
+		}
 	}
-	fmt.Print(result)
-	return nil
+	return exitcode.ForResults(failed_actions, 0, 0, opts.Fail_On), nil
 }
@@ -1,73 +1,27 @@
 package local
 
 import (
+	"context"
 	"fmt"
-	"strings"
 
-	"github.com/puppetlabs/regulator/localexec"
-	"github.com/puppetlabs/regulator/localfile"
+	"github.com/puppetlabs/regulator/exitcode"
 	"github.com/puppetlabs/regulator/operation"
 	"github.com/puppetlabs/regulator/operparse"
 	"github.com/puppetlabs/regulator/render"
 	"github.com/puppetlabs/regulator/rgerror"
 )
 
+// Deprecated: use engine.Engine.RunObservation, this runs it with a
+// default engine
 func RunObservation(name string, obsv operation.Observation, impls map[string]operation.Implement) operation.ObservationResult {
-	entity := obsv.Entity
-	query := obsv.Query
-
-	for _, impl := range impls {
-		if impl.Observes.Query == query && impl.Observes.Entity == entity {
-			impl_file := impl.Path
-			impl_script := impl.Script
-			executable := impl.Exe
-			args := operparse.ComputeArgs(impl.Observes.Args, obsv)
-			output, logs, cmd_rgerr := localexec.BuildAndRunCommand(executable, impl_file, impl_script, args)
-			if cmd_rgerr != nil {
-				return operation.ObservationResult{
-					Succeeded:   false,
-					Result:      "Error: " + strings.TrimSpace(cmd_rgerr.Message),
-					Expected:    false,
-					Logs:        logs,
-					Observation: obsv,
-				}
-			} else {
-				result := operation.ObservationResult{
-					Succeeded:   true,
-					Result:      output,
-					Logs:        logs,
-					Observation: obsv,
-				}
-				if obsv.Expect == output || obsv.Expect == "" {
-					result.Expected = true
-				} else {
-					result.Expected = false
-				}
-				return result
-			}
-		}
-	}
-	return operation.ObservationResult{
-		Succeeded:   false,
-		Result:      "Error: No implement found for observation '" + name + "'",
-		Observation: obsv,
-	}
+	return newEngine(RunOptions{}).RunObservation(context.Background(), name, obsv, impls)
 }
 
+// Deprecated: use engine.Engine.Observe, this runs them one at a time with
+// a default engine
 func RunAllObservations(obsvs map[string]operation.Observation, impls map[string]operation.Implement) operation.ObservationResults {
-	results := operation.ObservationResults{Observations: make(map[string]operation.ObservationResult)}
-	for obsv_name, obsv := range obsvs {
-		this_result := RunObservation(obsv_name, obsv, impls)
-		results.Observations[obsv_name] = this_result
-		results.Total_Observations++
-		if this_result.Succeeded == false {
-			results.Failed_Observations++
-		}
-		if this_result.Expected == false {
-			results.Unexpected_Observations++
-		}
-	}
-	return results
+	results, _ := newEngine(RunOptions{}).Observe(context.Background(), &operation.Operations{Observations: obsvs, Implements: impls})
+	return *results
 }
 
 func Observe(raw_data []byte) (string, *rgerror.RGerror) {
@@ -79,8 +33,20 @@ func Observe(raw_data []byte) (string, *rgerror.RGerror) {
 	if parse_rgerr != nil {
 		return "", parse_rgerr
 	}
-	results := RunAllObservations(data.Observations, data.Implements)
-	final_result, parse_rgerr := render.RenderJson(results)
+	return ObserveOperations(&data, RunOptions{})
+}
+
+// Results are rendered the way opts.Render says, JSON by default
+func ObserveOperations(data *operation.Operations, opts RunOptions) (string, *rgerror.RGerror) {
+	renderer, rgerr := render.NewRenderer(opts.Render)
+	if rgerr != nil {
+		return "", rgerr
+	}
+	results, rgerr := newEngine(opts).Observe(context.Background(), data)
+	if rgerr != nil {
+		return "", rgerr
+	}
+	final_result, parse_rgerr := renderer.RenderObservations(results)
 	if parse_rgerr != nil {
 		return "", parse_rgerr
 	}
@@ -88,16 +54,26 @@ func Observe(raw_data []byte) (string, *rgerror.RGerror) {
 	return final_result, nil
 }
 
-func CLIObserve(maybe_file string) *rgerror.RGerror {
-	// ReadFileOrStdin performs validation on maybe_file
-	raw_data, rgerr := localfile.ReadFileOrStdin(maybe_file)
+// Returns the exit code for the results, see the exitcode package
+func CLIObserve(spec_sources []string, opts RunOptions) (int, *rgerror.RGerror) {
+	renderer, rgerr := checkRunOptions(opts)
+	if rgerr != nil {
+		return exitcode.ForError(rgerr), rgerr
+	}
+	data, rgerr := loadSpecs(spec_sources, opts, true)
+	if rgerr != nil {
+		return exitcode.ForError(rgerr), rgerr
+	}
+	ctx, stop := interruptContext()
+	results, rgerr := newEngine(opts).Observe(ctx, data)
+	stop()
 	if rgerr != nil {
-		return rgerr
+		return exitcode.ForError(rgerr), rgerr
 	}
-	result, rgerr := Observe(raw_data)
+	final_result, rgerr := renderer.RenderObservations(results)
 	if rgerr != nil {
-		return rgerr
+		return exitcode.ForError(rgerr), rgerr
 	}
-	fmt.Printf(result)
-	return nil
+	fmt.Print(final_result)
+	return exitcode.ForResults(0, results.Failed_Observations, results.Unexpected_Observations, opts.Fail_On), nil
 }
@@ -0,0 +1,65 @@
+package local
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/puppetlabs/regulator/exitcode"
+	"github.com/puppetlabs/regulator/operation"
+	"github.com/puppetlabs/regulator/operparse"
+	"github.com/puppetlabs/regulator/render"
+	"github.com/puppetlabs/regulator/rgerror"
+)
+
+func Plan(raw_data []byte) (string, *rgerror.RGerror) {
+	var data operation.Operations
+	parse_rgerr := operparse.ParseOperations(raw_data, &data)
+	if parse_rgerr != nil {
+		return "", parse_rgerr
+	}
+	return PlanOperations(&data, RunOptions{})
+}
+
+// Observations still run (they're needed to know what would happen), but
+// no actions or implement reactions do
+func PlanOperations(data *operation.Operations, opts RunOptions) (string, *rgerror.RGerror) {
+	renderer, rgerr := render.NewRenderer(opts.Render)
+	if rgerr != nil {
+		return "", rgerr
+	}
+	results, rgerr := newEngine(opts).Plan(context.Background(), data)
+	if rgerr != nil {
+		return "", rgerr
+	}
+	final_result, parse_rgerr := renderer.RenderReactions(results)
+	if parse_rgerr != nil {
+		return "", parse_rgerr
+	}
+
+	return final_result, nil
+}
+
+// Returns the exit code for the results, see the exitcode package. Nothing
+// is run when planning, so only observations can fail.
+func CLIPlan(spec_sources []string, opts RunOptions) (int, *rgerror.RGerror) {
+	renderer, rgerr := checkRunOptions(opts)
+	if rgerr != nil {
+		return exitcode.ForError(rgerr), rgerr
+	}
+	data, rgerr := loadSpecs(spec_sources, opts, false)
+	if rgerr != nil {
+		return exitcode.ForError(rgerr), rgerr
+	}
+	ctx, stop := interruptContext()
+	results, rgerr := newEngine(opts).Plan(ctx, data)
+	stop()
+	if rgerr != nil {
+		return exitcode.ForError(rgerr), rgerr
+	}
+	final_result, rgerr := renderer.RenderReactions(results)
+	if rgerr != nil {
+		return exitcode.ForError(rgerr), rgerr
+	}
+	fmt.Print(final_result)
+	return exitcode.ForResults(0, results.Failed_Observations, results.Unexpected_Observations, opts.Fail_On), nil
+}
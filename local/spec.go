@@ -0,0 +1,104 @@
+package local
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/puppetlabs/regulator/engine"
+	"github.com/puppetlabs/regulator/exitcode"
+	"github.com/puppetlabs/regulator/operation"
+	"github.com/puppetlabs/regulator/operparse"
+	"github.com/puppetlabs/regulator/render"
+	"github.com/puppetlabs/regulator/rgerror"
+)
+
+// Settings from the command line that change how a spec is run. The zero
+// value runs everything one at a time, with no timeouts, for real.
+type RunOptions struct {
+	// From --timeout, used by anything that doesn't set its own timeout
+	Default_Timeout string
+	// From --parallelism, how many observations can run at once
+	Parallelism int
+	// From --noop, only used when reacting
+	Noop bool
+	// From --fail-on, which results make regulator exit non-zero (see
+	// the exitcode package). Only used by the CLI functions.
+	Fail_On string
+	// From --only, --skip, and --tags, which parts of the spec to run
+	Selector operation.Selector
+	// From --format, --pretty, and --color, how results are printed
+	Render render.Options
+}
+
+// Checks the options that don't need a spec, so a bad flag is reported
+// before anything runs, and returns the renderer for the results
+func checkRunOptions(opts RunOptions) (render.Renderer, *rgerror.RGerror) {
+	rgerr := exitcode.CheckFailOn(opts.Fail_On)
+	if rgerr != nil {
+		return nil, rgerr
+	}
+	return render.NewRenderer(opts.Render)
+}
+
+// Loads the spec for a CLI command, giving anything without its own
+// timeout the one from --timeout, and picks out the operations the
+// selector wants (only the observations, for observe)
+func loadSpecs(spec_sources []string, opts RunOptions, observe_only bool) (*operation.Operations, *rgerror.RGerror) {
+	data, rgerr := operparse.LoadSpecs(spec_sources)
+	if rgerr != nil {
+		return nil, rgerr
+	}
+	rgerr = operparse.ApplyDefaultTimeout(data, opts.Default_Timeout)
+	if rgerr != nil {
+		return nil, rgerr
+	}
+	if observe_only {
+		return operparse.SelectObservations(data, opts.Selector)
+	}
+	return operparse.SelectOperations(data, opts.Selector)
+}
+
+// The engine that runs a spec for these options, everything not about
+// running it (loading, selecting, rendering) is left to the caller
+func newEngine(opts RunOptions) *engine.Engine {
+	return engine.New(engine.Options{
+		Parallelism: opts.Parallelism,
+		Noop:        opts.Noop,
+	})
+}
+
+// A context for a CLI run that's cancelled by Ctrl-C or SIGTERM, which
+// kills anything the run started (commands that can be killed get their
+// own process group, so the signal doesn't reach them otherwise). If it
+// was cancelled, stop exits once the run has stopped, without printing
+// anything, the way regulator would have died from the signal.
+func interruptContext() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	caught := make(chan os.Signal, 1)
+	go func() {
+		select {
+		case sig := <-signals:
+			cancel()
+			caught <- sig
+		case <-ctx.Done():
+			caught <- nil
+		}
+	}()
+	stop := func() {
+		signal.Stop(signals)
+		cancel()
+		if sig := <-caught; sig != nil {
+			// What a shell reports for a command killed by the signal
+			code := exitcode.ERROR
+			if number, ok := sig.(syscall.Signal); ok {
+				code = 128 + int(number)
+			}
+			os.Exit(code)
+		}
+	}
+	return ctx, stop
+}
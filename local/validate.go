@@ -0,0 +1,56 @@
+package local
+
+import (
+	"fmt"
+
+	"github.com/puppetlabs/regulator/operation"
+	"github.com/puppetlabs/regulator/operparse"
+	"github.com/puppetlabs/regulator/render"
+	"github.com/puppetlabs/regulator/rgerror"
+)
+
+func Validate(raw_data []byte) (string, *rgerror.RGerror) {
+	var data operation.Operations
+	parse_rgerr := operparse.ParseOperations(raw_data, &data)
+	if parse_rgerr != nil {
+		return "", parse_rgerr
+	}
+	rgerr := operparse.CheckReactionGraph(&data)
+	if rgerr != nil {
+		return "", rgerr
+	}
+	return ValidateOperations(&data)
+}
+
+// Nothing is run here, parsing already checked each operation on its own
+// so all that's left is checking the references between them
+func ValidateOperations(data *operation.Operations) (string, *rgerror.RGerror) {
+	rgerr := operparse.CheckReferences(data)
+	if rgerr != nil {
+		return "", rgerr
+	}
+	final_result, rgerr := render.RenderJson(operation.ValidationResult{
+		Valid:              true,
+		Total_Observations: len(data.Observations),
+		Total_Reactions:    len(data.Reactions),
+		Total_Actions:      len(data.Actions),
+		Total_Implements:   len(data.Implements),
+	})
+	if rgerr != nil {
+		return "", rgerr
+	}
+	return final_result, nil
+}
+
+func CLIValidate(spec_sources []string) *rgerror.RGerror {
+	data, rgerr := operparse.LoadSpecs(spec_sources)
+	if rgerr != nil {
+		return rgerr
+	}
+	result, rgerr := ValidateOperations(data)
+	if rgerr != nil {
+		return rgerr
+	}
+	fmt.Print(result)
+	return nil
+}
@@ -0,0 +1,116 @@
+package localexec
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// How long an escalated command has to stop after being asked to when it
+// times out
+var BECOME_KILL_GRACE time.Duration = 5 * time.Second
+
+// What escalation commands print when they need a password they weren't
+// allowed to ask for
+var BECOME_PASSWORD_ERRORS []string = []string{
+	"a password is required",
+	"a terminal is required",
+	"Authorization required",
+	"Authentication required",
+}
+
+// Builds the escalation command that runs executable as Become_User, and
+// the environment to run it with:
+//
+//	sudo -n -u USER --preserve-env=NAME,... -- EXECUTABLE ARGS...
+//
+// Escalation commands reset the environment, so the variables the command
+// should get are named in --preserve-env. Their values only go through the
+// environment, never the command line where anyone could see them with ps.
+// Everything else is whatever the escalation command leaves, which is
+// already about as clean as Clean_Env would make it.
+func becomeCommand(executable string, args []string, opts ExecOptions) (string, []string, []string) {
+	env := specEnv(opts)
+	become_args := []string{"-n"}
+	if opts.Become_User != "" {
+		become_args = append(become_args, "-u", opts.Become_User)
+	}
+	if names := envNames(env); len(names) > 0 {
+		become_args = append(become_args, "--preserve-env="+strings.Join(names, ","))
+	}
+	become_args = append(become_args, "--", executable)
+	become_args = append(become_args, args...)
+	return opts.Become_Exe, become_args, append(os.Environ(), env...)
+}
+
+// The variables the spec gives the command, everything it inherits too
+// with Clean_Env
+func specEnv(opts ExecOptions) []string {
+	if opts.Clean_Env {
+		return append(baseEnv(opts), opts.Extra_Env...)
+	}
+	return opts.Extra_Env
+}
+
+// The names of "NAME=value" variables, each once
+func envNames(env []string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, variable := range env {
+		name := strings.SplitN(variable, "=", 2)[0]
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// The command as it's reported in results, with the value of any
+// "NAME=value" argument that sets one of the variables in env hidden,
+// since env values are often secrets
+func redactEnv(command []string, env []string) []string {
+	names := make(map[string]bool)
+	for _, name := range envNames(env) {
+		names[name] = true
+	}
+	redacted := make([]string, 0, len(command))
+	for _, arg := range command {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) == 2 && names[parts[0]] {
+			arg = parts[0] + "=" + REDACTED_ENV_VALUE
+		}
+		redacted = append(redacted, arg)
+	}
+	return redacted
+}
+
+// What redactEnv replaces values with
+var REDACTED_ENV_VALUE string = "[redacted]"
+
+// Whether an escalation command failed because it needed a password. Only
+// lines from the escalation command itself count, so a command that
+// happens to print one of these isn't mistaken for a password failure
+func BecomeNeedsPassword(become_exe string, logs string) bool {
+	prefix := filepath.Base(become_exe) + ":"
+	for _, line := range strings.Split(logs, "\n") {
+		line = strings.TrimSpace(line)
+		if !strings.HasPrefix(line, prefix) {
+			continue
+		}
+		for _, password_error := range BECOME_PASSWORD_ERRORS {
+			if strings.Contains(line, password_error) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func becomeUserName(become_user string) string {
+	if become_user == "" {
+		return "root"
+	}
+	return become_user
+}
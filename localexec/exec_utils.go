@@ -2,38 +2,206 @@ package localexec
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
+	"time"
 
 	"github.com/puppetlabs/regulator/localfile"
 	"github.com/puppetlabs/regulator/rgerror"
-	"github.com/puppetlabs/regulator/sanitize"
 )
 
+// Extra settings for running a command, the zero value runs it the same
+// way ExecReadOutput does
+type ExecOptions struct {
+	// Added to (and overriding) the environment regulator was run with,
+	// each one is "NAME=value"
+	Extra_Env []string
+	// Don't inherit regulator's environment, except for the variables
+	// named in Keep_Env. Extra_Env is still added.
+	Clean_Env bool
+	Keep_Env  []string
+	// The directory to run the command in, regulator's own if empty
+	Dir string
+	// Run the command through this escalation command (e.g. sudo) as
+	// Become_User, or root if that's empty. Not escalated if empty.
+	Become_Exe  string
+	Become_User string
+	// How long the command can run before it (and anything it started)
+	// is killed, 0 means it can run forever
+	Timeout time.Duration
+}
+
+// What happened when a command was run, for results to report
+type ExecInfo struct {
+	// The command as it was run, including any become command, with the
+	// executable's full path if it was found
+	Command []string
+	// -1 if the command was killed, or never started
+	Exit_Code  int
+	Started_At time.Time
+	Duration   time.Duration
+	// False if the command couldn't be started at all
+	Started bool
+}
+
 func ExecReadOutput(executable string, args []string) (string, string, *rgerror.RGerror) {
-	shell_command := exec.Command(executable, args...)
-	shell_command.Env = os.Environ()
+	output, logs, _, rgerr := ExecReadOutputWithOptions(executable, args, ExecOptions{})
+	return output, logs, rgerr
+}
+
+// When a command times out it's killed along with its whole process group.
+// Killing just the command isn't enough, anything it started (like the
+// shell running a script) can keep stdout open and hang us anyway.
+//
+// Escalated commands run as a user we can't send signals to, so they're
+// asked to stop through the escalation command first (sudo passes signals
+// on) and only killed outright if they're still running after
+// BECOME_KILL_GRACE.
+func ExecReadOutputWithOptions(executable string, args []string, opts ExecOptions) (string, string, ExecInfo, *rgerror.RGerror) {
+	return ExecReadOutputWithContext(context.Background(), executable, args, opts)
+}
+
+// The same as ExecReadOutputWithOptions, except the command is also killed
+// if ctx is done before it finishes. Nothing is started if it's already
+// done.
+func ExecReadOutputWithContext(ctx context.Context, executable string, args []string, opts ExecOptions) (string, string, ExecInfo, *rgerror.RGerror) {
+	if ctx.Err() != nil {
+		return "", "", ExecInfo{Exit_Code: -1}, contextError(ctx, executable, opts)
+	}
+	// Only commands that might need killing get their own process group.
+	// Anything else stays in regulator's, so a Ctrl-C in the terminal
+	// reaches it (and whatever it started) too.
+	killable := opts.Timeout > 0 || ctx.Done() != nil
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+	var shell_command *exec.Cmd
+	if opts.Become_Exe != "" {
+		become_exe, become_args, env := becomeCommand(executable, args, opts)
+		shell_command = exec.Command(become_exe, become_args...)
+		shell_command.Env = env
+	} else {
+		shell_command = exec.Command(executable, args...)
+		shell_command.Env = append(baseEnv(opts), opts.Extra_Env...)
+	}
+	shell_command.Dir = opts.Dir
+	if killable {
+		setProcessGroup(shell_command)
+	}
 	var stdout, stderr bytes.Buffer
 	shell_command.Stdout = &stdout
 	shell_command.Stderr = &stderr
-	err := shell_command.Run()
-	output := sanitize.ReplaceAllNewlines(stdout.String())
-	logs := sanitize.ReplaceAllNewlines(stderr.String())
+	info := ExecInfo{
+		Command:    redactEnv(append([]string{shell_command.Path}, shell_command.Args[1:]...), specEnv(opts)),
+		Exit_Code:  -1,
+		Started_At: time.Now(),
+	}
+	err := shell_command.Start()
+	if err == nil {
+		info.Started = true
+		done := make(chan error, 1)
+		go func() {
+			done <- shell_command.Wait()
+		}()
+		select {
+		case err = <-done:
+		case <-ctx.Done():
+			if opts.Become_Exe != "" {
+				terminateProcessGroup(shell_command)
+				select {
+				case err = <-done:
+				case <-time.After(BECOME_KILL_GRACE):
+					killProcessGroup(shell_command)
+					err = <-done
+				}
+			} else {
+				killProcessGroup(shell_command)
+				err = <-done
+			}
+		}
+	}
+	info.Duration = time.Since(info.Started_At)
+	if shell_command.ProcessState != nil {
+		info.Exit_Code = shell_command.ProcessState.ExitCode()
+	}
+	// Passed back exactly as printed, it's up to the caller to clean them
+	// up (see operation.CleanOutput)
+	output := stdout.String()
+	logs := stderr.String()
+	if ctx.Err() != nil {
+		rgerr := contextError(ctx, shell_command.String(), opts)
+		rgerr.Message += "\nstderr:\n" + logs
+		return output, logs, info, rgerr
+	}
+	if err != nil && opts.Become_Exe != "" && BecomeNeedsPassword(opts.Become_Exe, logs) {
+		return output, logs, info, &rgerror.RGerror{
+			Kind: rgerror.EscalationError,
+			Message: fmt.Sprintf(
+				"Could not run '%s' as %s, '%s' asked for a password and regulator can't give one. The user regulator runs as must be able to use '%s' without a password (e.g. NOPASSWD in sudoers)\nstderr:\n%s",
+				executable, becomeUserName(opts.Become_User), opts.Become_Exe, opts.Become_Exe, logs,
+			),
+			Origin: err,
+		}
+	}
 	if err != nil {
-		return output, logs, &rgerror.RGerror{
+		return output, logs, info, &rgerror.RGerror{
 			Kind:    rgerror.ShellError,
 			Message: fmt.Sprintf("Command '%s' failed:\n%s\nstderr:\n%s", shell_command, err, logs),
 			Origin:  err,
 		}
 	}
-	return output, logs, nil
+	return output, logs, info, nil
+}
+
+// Why a command was killed, or never started, once ctx is done
+func contextError(ctx context.Context, command string, opts ExecOptions) *rgerror.RGerror {
+	if ctx.Err() != context.DeadlineExceeded {
+		return &rgerror.RGerror{
+			Kind:    rgerror.ShellError,
+			Message: fmt.Sprintf("Command '%s' was cancelled", command),
+			Origin:  ctx.Err(),
+		}
+	}
+	if opts.Timeout > 0 {
+		return &rgerror.RGerror{
+			Kind:    rgerror.TimeoutError,
+			Message: fmt.Sprintf("Command '%s' did not finish within %s and was killed", command, opts.Timeout),
+			Origin:  ctx.Err(),
+		}
+	}
+	return &rgerror.RGerror{
+		Kind:    rgerror.TimeoutError,
+		Message: fmt.Sprintf("Command '%s' did not finish before its deadline and was killed", command),
+		Origin:  ctx.Err(),
+	}
 }
 
-func ExecScriptReadOutput(executable string, script string, args []string) (string, string, *rgerror.RGerror) {
+// The environment a command starts from before Extra_Env is added
+func baseEnv(opts ExecOptions) []string {
+	if !opts.Clean_Env {
+		return os.Environ()
+	}
+	var env []string
+	for _, name := range opts.Keep_Env {
+		if value, found := os.LookupEnv(name); found {
+			env = append(env, name+"="+value)
+		}
+	}
+	return env
+}
+
+func ExecScriptReadOutput(executable string, script string, args []string, opts ExecOptions) (string, string, ExecInfo, *rgerror.RGerror) {
+	return ExecScriptReadOutputWithContext(context.Background(), executable, script, args, opts)
+}
+
+func ExecScriptReadOutputWithContext(ctx context.Context, executable string, script string, args []string, opts ExecOptions) (string, string, ExecInfo, *rgerror.RGerror) {
 	f, err := os.CreateTemp("", "regulator_script")
 	if err != nil {
-		return "", "", &rgerror.RGerror{
+		return "", "", ExecInfo{Exit_Code: -1}, &rgerror.RGerror{
 			Kind:    rgerror.ShellError,
 			Message: "Could not create tmp file!",
 			Origin:  err,
@@ -42,24 +210,34 @@ func ExecScriptReadOutput(executable string, script string, args []string) (stri
 	filename := f.Name()
 	defer os.Remove(filename) // clean up
 	localfile.OverwriteFile(filename, []byte(script))
+	if opts.Become_User != "" {
+		// Temp files are only readable by us, which is fine for root but
+		// not for anyone else
+		os.Chmod(filename, 0644)
+	}
 	final_args := append([]string{filename}, args...)
-	return ExecReadOutput(executable, final_args)
+	return ExecReadOutputWithContext(ctx, executable, final_args, opts)
+}
+
+func BuildAndRunCommand(executable string, file string, script string, args []string, opts ExecOptions) (string, string, ExecInfo, *rgerror.RGerror) {
+	return BuildAndRunCommandWithContext(context.Background(), executable, file, script, args, opts)
 }
 
-func BuildAndRunCommand(executable string, file string, script string, args []string) (string, string, *rgerror.RGerror) {
+func BuildAndRunCommandWithContext(ctx context.Context, executable string, file string, script string, args []string, opts ExecOptions) (string, string, ExecInfo, *rgerror.RGerror) {
 	var output, logs string
+	var info ExecInfo
 	var rgerr *rgerror.RGerror
 	if len(file) > 0 {
 		final_args := append([]string{file}, args...)
-		output, logs, rgerr = ExecReadOutput(executable, final_args)
+		output, logs, info, rgerr = ExecReadOutputWithContext(ctx, executable, final_args, opts)
 	} else if len(script) > 0 {
-		output, logs, rgerr = ExecScriptReadOutput(executable, script, args)
+		output, logs, info, rgerr = ExecScriptReadOutputWithContext(ctx, executable, script, args, opts)
 	} else {
-		output, logs, rgerr = ExecReadOutput(executable, args)
+		output, logs, info, rgerr = ExecReadOutputWithContext(ctx, executable, args, opts)
 	}
 	if rgerr != nil {
-		return output, logs, rgerr
+		return output, logs, info, rgerr
 	}
 
-	return output, logs, nil
+	return output, logs, info, nil
 }
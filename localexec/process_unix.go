@@ -0,0 +1,31 @@
+//go:build !windows
+
+package localexec
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// Puts the command in its own process group so killProcessGroup can
+// kill everything it started
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func killProcessGroup(cmd *exec.Cmd) {
+	if cmd.Process == nil {
+		return
+	}
+	// A negative pid signals the whole group
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// Asks the whole group to stop, escalation commands like sudo pass this on
+// to the command they're running
+func terminateProcessGroup(cmd *exec.Cmd) {
+	if cmd.Process == nil {
+		return
+	}
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+}
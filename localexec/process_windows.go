@@ -0,0 +1,22 @@
+//go:build windows
+
+package localexec
+
+import (
+	"os/exec"
+)
+
+// Windows doesn't have process groups we can signal, so only the command
+// itself is killed
+func setProcessGroup(cmd *exec.Cmd) {}
+
+func killProcessGroup(cmd *exec.Cmd) {
+	if cmd.Process == nil {
+		return
+	}
+	cmd.Process.Kill()
+}
+
+func terminateProcessGroup(cmd *exec.Cmd) {
+	killProcessGroup(cmd)
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/puppetlabs/regulator/rgerror"
@@ -22,31 +23,78 @@ func readFromStdin() string {
 	return builder.String()
 }
 
-func ChooseFileOrStdin(specfile string, use_stdin bool) (string, *rgerror.RGerror) {
+// Works out which spec sources the CLI flags point at. Sources are read in
+// the order returned: every *.yaml file in spec_dir sorted by name, then each
+// --file in the order given. Stdin can't be combined with anything else.
+func ChooseSpecSources(specfiles []string, spec_dir string, use_stdin bool) ([]string, *rgerror.RGerror) {
 	if use_stdin {
-		if len(specfile) > 0 {
-			return "", &rgerror.RGerror{
+		if len(specfiles) > 0 || len(spec_dir) > 0 {
+			return nil, &rgerror.RGerror{
 				Kind:    rgerror.InvalidInput,
-				Message: "Cannot specify both a file and to use stdin",
+				Message: "Cannot specify both a file or directory and to use stdin",
 				Origin:  nil,
 			}
 		}
-		return STDIN_IDENTIFIER, nil
-	} else {
-		// Validate that the thing is actually a file on disk before
-		// going any further
-		//
-		// Cheat a little with the validator: this function is mostly used
-		// for the CLI commands, so use a name that shows it's the flag
-		rgerr := validator.ValidateParams(fmt.Sprintf(
-			`[{"name":"--file","value":"%s","validate":["NotEmpty","IsFile"]}]`,
-			specfile,
-		))
+		return []string{STDIN_IDENTIFIER}, nil
+	}
+	if len(specfiles) == 0 && len(spec_dir) == 0 {
+		return nil, &rgerror.RGerror{
+			Kind:    rgerror.InvalidInput,
+			Message: "Must use at least one of --file, --dir, or --stdin",
+			Origin:  nil,
+		}
+	}
+	var sources []string
+	if len(spec_dir) > 0 {
+		dir_files, rgerr := ListSpecDir(spec_dir)
 		if rgerr != nil {
-			return "", rgerr
+			return nil, rgerr
+		}
+		sources = append(sources, dir_files...)
+	}
+	// Validate that every --file is actually a file on disk before going
+	// any further, all at once so every bad one is reported
+	//
+	// Cheat a little with the validator: this function is mostly used
+	// for the CLI commands, so use a name that shows it's the flag
+	var params []validator.Param
+	for _, specfile := range specfiles {
+		params = append(params, validator.Param{Name: "--file", Value: specfile, Rules: []validator.Rule{validator.NotEmpty, validator.IsFile}})
+	}
+	rgerr := validator.Validate(params...)
+	if rgerr != nil {
+		return nil, rgerr
+	}
+	sources = append(sources, specfiles...)
+	return sources, nil
+}
+
+// Lists every *.yaml file directly inside a directory, sorted by name so
+// that specs are always loaded in the same order
+func ListSpecDir(spec_dir string) ([]string, *rgerror.RGerror) {
+	rgerr := validator.Validate(
+		validator.Param{Name: "--dir", Value: spec_dir, Rules: []validator.Rule{validator.IsDir}},
+	)
+	if rgerr != nil {
+		return nil, rgerr
+	}
+	// Glob results are already sorted
+	dir_files, err := filepath.Glob(filepath.Join(spec_dir, "*.yaml"))
+	if err != nil {
+		return nil, &rgerror.RGerror{
+			Kind:    rgerror.ExecError,
+			Message: fmt.Sprintf("Failed to list spec files in %s:\n%s", spec_dir, err),
+			Origin:  err,
+		}
+	}
+	if len(dir_files) == 0 {
+		return nil, &rgerror.RGerror{
+			Kind:    rgerror.InvalidInput,
+			Message: fmt.Sprintf("'--dir' %s does not contain any .yaml files", spec_dir),
+			Origin:  nil,
 		}
-		return specfile, nil
 	}
+	return dir_files, nil
 }
 
 func ReadFileOrStdin(maybe_file string) ([]byte, *rgerror.RGerror) {
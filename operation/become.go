@@ -0,0 +1,32 @@
+package operation
+
+// Running an observation's implement or an action as another user, root
+// unless become_user says otherwise, e.g.:
+//
+//	become: true
+//	become_user: postgres
+//
+// The command is run through become_exe (DEFAULT_BECOME_EXE if not set),
+// which must accept sudo's -n, -u, and --preserve-env=LIST flags, the
+// last of which is how env values get to the command. It's always run
+// non-interactively, so the user regulator runs as has to be able to
+// escalate without a password.
+type Become struct {
+	Become      bool   `yaml:"become,omitempty" json:"become,omitempty"`
+	Become_User string `yaml:"become_user,omitempty" json:"become_user,omitempty"`
+	Become_Exe  string `yaml:"become_exe,omitempty" json:"become_exe,omitempty"`
+}
+
+var DEFAULT_BECOME_EXE string = "sudo"
+
+// The escalation command to run through, empty if the command shouldn't
+// be run as anyone else
+func (become Become) Exe() string {
+	if !become.Become {
+		return ""
+	}
+	if become.Become_Exe == "" {
+		return DEFAULT_BECOME_EXE
+	}
+	return become.Become_Exe
+}
@@ -0,0 +1,28 @@
+package operation
+
+// The environment an observation's implement or an action runs in, e.g.:
+//
+//	env:
+//	  APP_ENV: production
+//	  TARGET: __obsv_instance__
+//	cwd: /opt/app
+//	clean_env: true
+//	keep_env: [SSH_AUTH_SOCK]
+//
+// Env values are substituted the same way args are, so __obsv_instance__
+// and __noop__ work there too. With clean_env nothing is inherited from
+// the environment regulator runs in except the variables in
+// CLEAN_ENV_ALWAYS_KEPT and keep_env.
+type Environment struct {
+	Env       map[string]string `yaml:"env,omitempty" json:"env,omitempty"`
+	Cwd       string            `yaml:"cwd,omitempty" json:"cwd,omitempty"`
+	Clean_Env bool              `yaml:"clean_env,omitempty" json:"clean_env,omitempty"`
+	Keep_Env  []string          `yaml:"keep_env,omitempty" json:"keep_env,omitempty"`
+}
+
+// Without these most scripts can't find anything to run
+var CLEAN_ENV_ALWAYS_KEPT []string = []string{"PATH", "HOME"}
+
+func (environment Environment) IsSet() bool {
+	return len(environment.Env) > 0 || environment.Cwd != "" || environment.Clean_Env || len(environment.Keep_Env) > 0
+}
@@ -0,0 +1,27 @@
+package operation
+
+// What actually happened when an implement or action was run, to debug
+// slow or flaky ones from the results alone. Observation, action, and
+// reaction results embed this, so the fields sit directly on the result.
+// Nothing is set for things that never got as far as running a command
+// (e.g. skipped reactions).
+//
+// With retries this describes the last attempt.
+type Execution struct {
+	// Not set if the command couldn't be started, -1 if it was killed
+	Exit_Code *int `yaml:"exit_code,omitempty" json:"exit_code,omitempty"`
+	// RFC 3339, with nanoseconds
+	Started_At  string `yaml:"started_at,omitempty" json:"started_at,omitempty"`
+	Duration_Ms int64  `yaml:"duration_ms,omitempty" json:"duration_ms,omitempty"`
+	Hostname    string `yaml:"hostname,omitempty" json:"hostname,omitempty"`
+	// The command as it was run, after args were computed, scripts were
+	// written to a temp file, and any become command was added
+	Command []string `yaml:"command,omitempty" json:"command,omitempty"`
+}
+
+// How long a whole observe or react run took, and where
+type RunTiming struct {
+	Started_At  string `yaml:"started_at,omitempty" json:"started_at,omitempty"`
+	Duration_Ms int64  `yaml:"duration_ms,omitempty" json:"duration_ms,omitempty"`
+	Hostname    string `yaml:"hostname,omitempty" json:"hostname,omitempty"`
+}
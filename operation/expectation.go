@@ -0,0 +1,211 @@
+package operation
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// What an observation expects its result to be. In specs this is either
+// a plain string, which the result has to equal exactly:
+//
+//	expect: RUNNING
+//
+// or a map of operators, all of which have to hold for the result to be
+// expected:
+//
+//	expect:
+//	  one_of: [RUNNING, STAGING]
+//	  regex: ^RUN
+//	  between: [2, 5]
+//	  not: TERMINATED
+//
+// 'not' takes another expectation, so it can be a plain string or a map.
+//
+// A nil *Expectation means the observation doesn't expect anything, and
+// every method here is safe to call on nil.
+type Expectation struct {
+	Equals  string       `yaml:"equals,omitempty" json:"equals,omitempty"`
+	One_Of  []string     `yaml:"one_of,omitempty" json:"one_of,omitempty"`
+	Regex   string       `yaml:"regex,omitempty" json:"regex,omitempty"`
+	Between []float64    `yaml:"between,omitempty" json:"between,omitempty"`
+	Not     *Expectation `yaml:"not,omitempty" json:"not,omitempty"`
+}
+
+// Used to (un)marshal the map form without recursing in to the custom
+// (un)marshalers below
+type rawExpectation Expectation
+
+func (expt *Expectation) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var plain string
+	if err := unmarshal(&plain); err == nil {
+		*expt = Expectation{Equals: plain}
+		return nil
+	}
+	var raw rawExpectation
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+	*expt = Expectation(raw)
+	return nil
+}
+
+// The same two forms as in specs, so results (and specs) written out as
+// JSON read back in
+func (expt *Expectation) UnmarshalJSON(data []byte) error {
+	var plain string
+	if err := json.Unmarshal(data, &plain); err == nil {
+		*expt = Expectation{Equals: plain}
+		return nil
+	}
+	var raw rawExpectation
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*expt = Expectation(raw)
+	return nil
+}
+
+// Plain string expectations are written back out as plain strings so
+// results look the same as the spec that produced them
+func (expt Expectation) MarshalJSON() ([]byte, error) {
+	if expt.IsPlain() {
+		return json.Marshal(expt.Equals)
+	}
+	return json.Marshal(rawExpectation(expt))
+}
+
+func (expt Expectation) MarshalYAML() (interface{}, error) {
+	if expt.IsPlain() {
+		return expt.Equals, nil
+	}
+	return rawExpectation(expt), nil
+}
+
+func (expt *Expectation) IsSet() bool {
+	if expt == nil {
+		return false
+	}
+	return expt.Equals != "" ||
+		len(expt.One_Of) > 0 ||
+		expt.Regex != "" ||
+		len(expt.Between) > 0 ||
+		expt.Not.IsSet()
+}
+
+// True if this is the plain string shorthand
+func (expt *Expectation) IsPlain() bool {
+	if expt == nil {
+		return false
+	}
+	return len(expt.One_Of) == 0 &&
+		expt.Regex == "" &&
+		len(expt.Between) == 0 &&
+		expt.Not == nil
+}
+
+// Checks the operators make sense, e.g. that the regex compiles. Meant
+// to be called at parse time so Matches never has to deal with errors.
+func (expt *Expectation) Validate() error {
+	if expt == nil {
+		return nil
+	}
+	if !expt.IsSet() {
+		return fmt.Errorf("expect must be a string or set at least one of 'equals', 'one_of', 'regex', 'between', or 'not'")
+	}
+	if expt.Regex != "" {
+		if _, err := regexp.Compile(expt.Regex); err != nil {
+			return fmt.Errorf("'%s' is not a valid regular expression: %s", expt.Regex, err)
+		}
+	}
+	if len(expt.Between) > 0 {
+		if len(expt.Between) != 2 || expt.Between[0] > expt.Between[1] {
+			return fmt.Errorf("'between' must be a list of two numbers, lowest first")
+		}
+	}
+	if expt.Not != nil {
+		if err := expt.Not.Validate(); err != nil {
+			return fmt.Errorf("in 'not': %s", err)
+		}
+	}
+	return nil
+}
+
+// Whether a result meets the expectation. Not expecting anything
+// means every result is expected.
+func (expt *Expectation) Matches(result string) bool {
+	if !expt.IsSet() {
+		return true
+	}
+	if expt.Equals != "" && result != expt.Equals {
+		return false
+	}
+	if len(expt.One_Of) > 0 {
+		found := false
+		for _, value := range expt.One_Of {
+			if result == value {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if expt.Regex != "" {
+		matcher, err := regexp.Compile(expt.Regex)
+		if err != nil || !matcher.MatchString(result) {
+			return false
+		}
+	}
+	if len(expt.Between) == 2 {
+		number, err := strconv.ParseFloat(strings.TrimSpace(result), 64)
+		if err != nil || number < expt.Between[0] || number > expt.Between[1] {
+			return false
+		}
+	}
+	if expt.Not.IsSet() && expt.Not.Matches(result) {
+		return false
+	}
+	return true
+}
+
+// Two expectations are equal if they accept exactly the same results as
+// far as we can tell without solving regexes, which is good enough to
+// find observations that conflict
+func (expt *Expectation) Equal(other *Expectation) bool {
+	return expt.String() == other.String()
+}
+
+// A readable (and canonical, one_of is sorted) description of the
+// expectation. Plain expectations are just the expected string.
+func (expt *Expectation) String() string {
+	if !expt.IsSet() {
+		return ""
+	}
+	if expt.IsPlain() {
+		return expt.Equals
+	}
+	var parts []string
+	if expt.Equals != "" {
+		parts = append(parts, fmt.Sprintf("equals '%s'", expt.Equals))
+	}
+	if len(expt.One_Of) > 0 {
+		sorted := append([]string{}, expt.One_Of...)
+		sort.Strings(sorted)
+		parts = append(parts, fmt.Sprintf("one of '%s'", strings.Join(sorted, "', '")))
+	}
+	if expt.Regex != "" {
+		parts = append(parts, fmt.Sprintf("matches /%s/", expt.Regex))
+	}
+	if len(expt.Between) == 2 {
+		parts = append(parts, fmt.Sprintf("between %v and %v", expt.Between[0], expt.Between[1]))
+	}
+	if expt.Not.IsSet() {
+		parts = append(parts, fmt.Sprintf("not (%s)", expt.Not))
+	}
+	return strings.Join(parts, " and ")
+}
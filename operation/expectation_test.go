@@ -0,0 +1,171 @@
+package operation
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+type expectationHolder struct {
+	Expect *Expectation `yaml:"expect,omitempty" json:"expect,omitempty"`
+}
+
+func TestExpectationRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want Expectation
+		// What the expectation should look like written back out as
+		// JSON, plain expectations stay plain strings
+		json string
+	}{
+		{
+			"plain",
+			"expect: RUNNING\n",
+			Expectation{Equals: "RUNNING"},
+			`{"expect":"RUNNING"}`,
+		},
+		{
+			"plain number",
+			"expect: 3\n",
+			Expectation{Equals: "3"},
+			`{"expect":"3"}`,
+		},
+		{
+			"equals in a map",
+			"expect:\n  equals: RUNNING\n",
+			Expectation{Equals: "RUNNING"},
+			`{"expect":"RUNNING"}`,
+		},
+		{
+			"map",
+			"expect:\n  one_of: [RUNNING, STAGING]\n  regex: ^RUN\n  between: [2, 5]\n",
+			Expectation{One_Of: []string{"RUNNING", "STAGING"}, Regex: "^RUN", Between: []float64{2, 5}},
+			`{"expect":{"one_of":["RUNNING","STAGING"],"regex":"^RUN","between":[2,5]}}`,
+		},
+		{
+			"plain not",
+			"expect:\n  not: TERMINATED\n",
+			Expectation{Not: &Expectation{Equals: "TERMINATED"}},
+			`{"expect":{"not":"TERMINATED"}}`,
+		},
+		{
+			"map not",
+			"expect:\n  not:\n    one_of: [a, b]\n",
+			Expectation{Not: &Expectation{One_Of: []string{"a", "b"}}},
+			`{"expect":{"not":{"one_of":["a","b"]}}}`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var from_yaml expectationHolder
+			if err := yaml.Unmarshal([]byte(test.yaml), &from_yaml); err != nil {
+				t.Fatalf("yaml unmarshal failed: %s", err)
+			}
+			if from_yaml.Expect == nil || !reflect.DeepEqual(*from_yaml.Expect, test.want) {
+				t.Fatalf("from yaml got %#v, want %#v", from_yaml.Expect, test.want)
+			}
+
+			raw_json, err := json.Marshal(from_yaml)
+			if err != nil {
+				t.Fatalf("json marshal failed: %s", err)
+			}
+			if string(raw_json) != test.json {
+				t.Errorf("json got %s, want %s", raw_json, test.json)
+			}
+			var from_json expectationHolder
+			if err := json.Unmarshal(raw_json, &from_json); err != nil {
+				t.Fatalf("json unmarshal failed: %s", err)
+			}
+			if !reflect.DeepEqual(from_json, from_yaml) {
+				t.Errorf("after json got %#v, want %#v", from_json.Expect, from_yaml.Expect)
+			}
+
+			raw_yaml, err := yaml.Marshal(from_yaml)
+			if err != nil {
+				t.Fatalf("yaml marshal failed: %s", err)
+			}
+			var from_yaml_again expectationHolder
+			if err := yaml.Unmarshal(raw_yaml, &from_yaml_again); err != nil {
+				t.Fatalf("yaml unmarshal of %q failed: %s", raw_yaml, err)
+			}
+			if !reflect.DeepEqual(from_yaml_again, from_yaml) {
+				t.Errorf("after yaml got %#v, want %#v", from_yaml_again.Expect, from_yaml.Expect)
+			}
+			if test.want.IsPlain() && strings.Contains(string(raw_yaml), "equals") {
+				t.Errorf("plain expectation written as a map: %q", raw_yaml)
+			}
+		})
+	}
+}
+
+func TestExpectationUnset(t *testing.T) {
+	var holder expectationHolder
+	if err := yaml.Unmarshal([]byte("{}"), &holder); err != nil {
+		t.Fatalf("yaml unmarshal failed: %s", err)
+	}
+	raw_json, err := json.Marshal(holder)
+	if err != nil || string(raw_json) != "{}" {
+		t.Errorf("got %s, %v, want {}", raw_json, err)
+	}
+	if !holder.Expect.Matches("anything") {
+		t.Errorf("no expectation should match everything")
+	}
+}
+
+func TestExpectationMatches(t *testing.T) {
+	expt := &Expectation{
+		One_Of:  []string{"3", "4", "9"},
+		Between: []float64{2, 5},
+		Not:     &Expectation{Equals: "4"},
+	}
+	tests := map[string]bool{
+		"3":   true,
+		"4":   false,
+		"9":   false,
+		"2":   false,
+		"abc": false,
+	}
+	for result, want := range tests {
+		if got := expt.Matches(result); got != want {
+			t.Errorf("Matches(%q) = %t, want %t", result, got, want)
+		}
+	}
+}
+
+func TestExpectationValidate(t *testing.T) {
+	tests := []struct {
+		name  string
+		expt  Expectation
+		valid bool
+	}{
+		{"plain", Expectation{Equals: "a"}, true},
+		{"empty", Expectation{}, false},
+		{"bad regex", Expectation{Regex: "["}, false},
+		{"between backwards", Expectation{Between: []float64{5, 1}}, false},
+		{"between one number", Expectation{Between: []float64{1}}, false},
+		{"bad not", Expectation{Not: &Expectation{Regex: "("}}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.expt.Validate()
+			if test.valid != (err == nil) {
+				t.Errorf("Validate() = %v, want valid %t", err, test.valid)
+			}
+		})
+	}
+}
+
+func TestExpectationEqual(t *testing.T) {
+	left := &Expectation{One_Of: []string{"b", "a"}}
+	right := &Expectation{One_Of: []string{"a", "b"}}
+	if !left.Equal(right) {
+		t.Errorf("one_of order shouldn't matter")
+	}
+	if left.Equal(&Expectation{Equals: "a"}) {
+		t.Errorf("different expectations should not be equal")
+	}
+}
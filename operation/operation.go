@@ -1,6 +1,7 @@
 package operation
 
 import (
+	"fmt"
 	"sort"
 	"strings"
 
@@ -23,10 +24,18 @@ type Operation interface {
 // Observations
 // ---------------------------------------------------------------
 type Observation struct {
-	Entity   string `yaml:"entity" json:"entity"`
-	Query    string `yaml:"query" json:"query"`
-	Instance string `yaml:"instance" json:"instance"`
-	Expect   string `yaml:"expect,omitempty" json:"expect,omitempty"`
+	Entity   string       `yaml:"entity" json:"entity"`
+	Query    string       `yaml:"query" json:"query"`
+	Instance string       `yaml:"instance" json:"instance"`
+	Expect   *Expectation `yaml:"expect,omitempty" json:"expect,omitempty"`
+	// Only used with implements that have 'output: json', selects the
+	// value from the implement's output that is compared with Expect
+	Expect_Path string `yaml:"expect_path,omitempty" json:"expect_path,omitempty"`
+	Override    bool   `yaml:"override,omitempty" json:"override,omitempty"`
+	// Takes precedence over the implement's retry settings
+	Retry `yaml:",inline"`
+	// For picking out parts of a spec with --tags, see Selector
+	Tags []string `yaml:"tags,omitempty" json:"tags,omitempty"`
 }
 
 type ObservationResult struct {
@@ -35,6 +44,14 @@ type ObservationResult struct {
 	Expected    bool        `yaml:"expected" json:"expected"`
 	Logs        string      `yaml:"logs" json:"logs"`
 	Observation Observation `yaml:"observation" json:"observation"`
+	// The parsed output of implements that have 'output: json'
+	Data interface{} `yaml:"data,omitempty" json:"data,omitempty"`
+	// True if the implement was killed for running past its timeout
+	Timed_Out bool `yaml:"timed_out,omitempty" json:"timed_out,omitempty"`
+	// Only set if the observation can be retried, how many times the
+	// implement was run. Logs has the output of every failed attempt.
+	Attempts  int `yaml:"attempts,omitempty" json:"attempts,omitempty"`
+	Execution `yaml:",inline"`
 }
 
 type ObservationResults struct {
@@ -42,6 +59,7 @@ type ObservationResults struct {
 	Total_Observations      int                          `yaml:"total_observations" json:"total_observations"`
 	Failed_Observations     int                          `yaml:"failed_observations" json:"failed_observations"`
 	Unexpected_Observations int                          `yaml:"unexpected_observations" json:"unexpected_observations"`
+	RunTiming               `yaml:",inline"`
 }
 
 // Observations can only conflict if
@@ -62,10 +80,11 @@ type ObservationResults struct {
 func (obsv Observation) HashKeys() []string {
 	result := []string{}
 	// Don't even return a hash key if there is no expect field
-	if obsv.Expect != "" {
+	if obsv.Expect.IsSet() {
 		hash := "OBS" + "EN" + sanitize.ReplaceAllSpaces(obsv.Entity) +
 			"QU" + sanitize.ReplaceAllSpaces(obsv.Query) +
-			"IN" + sanitize.ReplaceAllSpaces(obsv.Instance)
+			"IN" + sanitize.ReplaceAllSpaces(obsv.Instance) +
+			"PA" + sanitize.ReplaceAllSpaces(obsv.Expect_Path)
 		result = append(result, hash)
 	}
 	return result
@@ -89,17 +108,39 @@ type Action struct {
 	Script string   `yaml:"script" json:"script"`
 	Exe    string   `yaml:"exe,omitempty" json:"exe,omitempty"`
 	Args   []string `yaml:"args,omitempty" json:"args,omitempty"`
+	// Whether the action understands the noop protocol (see operparse),
+	// actions with __noop__ in their args always do
+	Supports_Noop bool `yaml:"supports_noop,omitempty" json:"supports_noop,omitempty"`
+	// How long the action can run before it's killed, e.g. "30s" or "5m".
+	// Not set means it can run forever (or as long as --timeout allows)
+	Timeout string `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	// How the action's output is cleaned up, see OUTPUT_MODES
+	Output string `yaml:"output,omitempty" json:"output,omitempty"`
+	// Replace an action with the same name from an earlier spec
+	// instead of failing
+	Override bool `yaml:"override,omitempty" json:"override,omitempty"`
+	// Settings shared with implements (and observations, for Retry). They
+	// are inlined, so their fields sit directly on the action in specs.
+	Retry       `yaml:",inline"`
+	Environment `yaml:",inline"`
+	Become      `yaml:",inline"`
+	// Same as Observation.Tags
+	Tags []string `yaml:"tags,omitempty" json:"tags,omitempty"`
 }
 
 type ActionResult struct {
 	Succeeded bool   `yaml:"succeeded" json:"succeeded"`
+	Timed_Out bool   `yaml:"timed_out,omitempty" json:"timed_out,omitempty"`
 	Output    string `yaml:"output" json:"output"`
 	Logs      string `yaml:"logs" json:"logs"`
 	Action    Action `yaml:"action" json:"action"`
+	// Same as ObservationResult.Attempts
+	Attempts  int `yaml:"attempts,omitempty" json:"attempts,omitempty"`
+	Execution `yaml:",inline"`
 }
 
 type ActionResults struct {
-	Actions map[string]ActionResult `json:"actions"`
+	Actions map[string]ActionResult `yaml:"actions" json:"actions"`
 }
 
 func (actn Action) HashKeys() []string {
@@ -124,19 +165,57 @@ type Reaction struct {
 	Observation string    `yaml:"observation" json:"observation"`
 	Action      string    `yaml:"action" json:"action"`
 	Condition   Condition `yaml:"condition" json:"condition"`
+	// Names of other reactions that must run (and not fail)
+	// before this reaction is allowed to run
+	Depends_On []string `yaml:"depends_on,omitempty" json:"depends_on,omitempty"`
+	// An expression evaluated against every observation result, the
+	// results of reactions that already ran, and the spec's vars. The
+	// reaction only runs if it's true (and the condition passes, if
+	// the reaction also has one)
+	When     string `yaml:"when,omitempty" json:"when,omitempty"`
+	Override bool   `yaml:"override,omitempty" json:"override,omitempty"`
+	// Same as Observation.Tags
+	Tags []string `yaml:"tags,omitempty" json:"tags,omitempty"`
 }
 
 type ReactionResult struct {
 	Succeeded bool     `yaml:"succeeded" json:"succeeded"`
 	Skipped   bool     `yaml:"skipped" json:"skipped"`
+	Timed_Out bool     `yaml:"timed_out,omitempty" json:"timed_out,omitempty"`
 	Output    string   `yaml:"output" json:"output"`
 	Logs      string   `yaml:"logs" json:"logs"`
 	Message   string   `yaml:"message" json:"message"`
 	Reaction  Reaction `yaml:"reaction" json:"reaction"`
+	// Only set for corrections: the observation result that
+	// triggered the correction and the result of observing
+	// again once the correction finished
+	Before *ObservationResult `yaml:"before,omitempty" json:"before,omitempty"`
+	After  *ObservationResult `yaml:"after,omitempty" json:"after,omitempty"`
+	// Only set when planning or running in noop mode: what the reaction
+	// would have run
+	Would_Run *PlannedAction `yaml:"would_run,omitempty" json:"would_run,omitempty"`
+	// Only set in noop mode, for reactions whose action supports noop:
+	// the action's own answer to whether it would have changed anything
+	Would_Change *bool `yaml:"would_change,omitempty" json:"would_change,omitempty"`
+	// From the action, if one was run
+	Execution `yaml:",inline"`
+}
+
+// An action (or implement) a reaction would run, Action has the args
+// already computed for the observation being reacted to
+type PlannedAction struct {
+	Name   string `yaml:"name" json:"name"`
+	Action Action `yaml:"action" json:"action"`
 }
 
 type ReactionResults struct {
+	// True if these are planned results and nothing was actually run
+	Dry_Run bool `yaml:"dry_run,omitempty" json:"dry_run,omitempty"`
+	// True if actions that support noop were run in noop mode and
+	// nothing else was run
+	Noop                    bool                         `yaml:"noop,omitempty" json:"noop,omitempty"`
 	Reactions               map[string]ReactionResult    `yaml:"reactions" json:"reactions"`
+	Reaction_Order          []string                     `yaml:"reaction_order" json:"reaction_order"`
 	Observations            map[string]ObservationResult `yaml:"observations" json:"observations"`
 	Total_Observations      int                          `yaml:"total_observations" json:"total_observations"`
 	Failed_Observations     int                          `yaml:"failed_observations" json:"failed_observations"`
@@ -144,6 +223,7 @@ type ReactionResults struct {
 	Total_Reactions         int                          `yaml:"total_reactions" json:"total_reactions"`
 	Failed_Reactions        int                          `yaml:"failed_reactions" json:"failed_reactions"`
 	Skipped_Reactions       int                          `yaml:"skipped_reactions" json:"skipped_reactions"`
+	RunTiming               `yaml:",inline"`
 }
 
 func (rctn Reaction) HashKeys() []string {
@@ -151,9 +231,16 @@ func (rctn Reaction) HashKeys() []string {
 	return []string{}
 }
 
+// A 'when' expression can stand in for the observation and condition,
+// except for corrections, which always need an observation to correct
 func (rctn Reaction) Empty() bool {
+	if rctn.Action == "" {
+		return true
+	}
+	if rctn.When != "" {
+		return rctn.Action == "correction" && rctn.Observation == ""
+	}
 	if rctn.Observation == "" ||
-		rctn.Action == "" ||
 		rctn.Condition.Check == "" ||
 		rctn.Condition.Value == "" {
 		return true
@@ -175,6 +262,8 @@ type Correction struct {
 type ReactionImplement struct {
 	Corrects Correction `yaml:"corrects,omitempty" json:"corrects,omitempty"`
 	Args     []string   `yaml:"args" json:"args"`
+	// Same as Action.Supports_Noop
+	Supports_Noop bool `yaml:"supports_noop,omitempty" json:"supports_noop,omitempty"`
 }
 
 type ObservationImplement struct {
@@ -183,12 +272,29 @@ type ObservationImplement struct {
 	Args   []string `yaml:"args" json:"args"`
 }
 
+// Implements normally return a plain string (see output.go), with
+// 'output: json' their output is parsed as JSON instead
+var IMPLEMENT_OUTPUT_JSON string = "json"
+
 type Implement struct {
 	Path     string               `yaml:"path,omitempty" json:"path,omitempty"`
 	Script   string               `yaml:"script,omitempty" json:"script,omitempty"`
 	Exe      string               `yaml:"exe" json:"exe"`
+	Output   string               `yaml:"output,omitempty" json:"output,omitempty"`
+	Timeout  string               `yaml:"timeout,omitempty" json:"timeout,omitempty"`
 	Reacts   ReactionImplement    `yaml:"reacts,omitempty" json:"reacts,omitempty"`
 	Observes ObservationImplement `yaml:"observes,omitempty" json:"observes,omitempty"`
+	Override bool                 `yaml:"override,omitempty" json:"override,omitempty"`
+	// Never run more than one observation using this implement at a time,
+	// for implements that can't safely run alongside themselves (e.g.
+	// anything holding a lock on the system)
+	Serial bool `yaml:"serial,omitempty" json:"serial,omitempty"`
+	// Used when observing unless the observation has its own, and when
+	// reacting
+	Retry `yaml:",inline"`
+	// Used both when observing and reacting
+	Environment `yaml:",inline"`
+	Become      `yaml:",inline"`
 }
 
 func emptyObserves(impl Implement) bool {
@@ -278,4 +384,59 @@ type Operations struct {
 	Observations map[string]Observation `yaml:"observations,omitempty" json:"observations,omitempty"`
 	Implements   map[string]Implement   `yaml:"implements,omitempty" json:"implements,omitempty"`
 	Actions      map[string]Action      `yaml:"actions,omitempty" json:"actions,omitempty"`
+	// Free form values that reaction 'when' expressions can refer to by name
+	Vars map[string]interface{} `yaml:"vars,omitempty" json:"vars,omitempty"`
+	// Other spec files (or globs) to load, relative paths are relative
+	// to the file that includes them
+	Include []string `yaml:"include,omitempty" json:"include,omitempty"`
+	// Filled in by operparse as specs are merged, not part of the spec itself
+	Provenance *Provenance `yaml:"-" json:"-"`
+}
+
+// What 'validate' prints for a spec that passed every check
+type ValidationResult struct {
+	Valid              bool `yaml:"valid" json:"valid"`
+	Total_Observations int  `yaml:"total_observations" json:"total_observations"`
+	Total_Reactions    int  `yaml:"total_reactions" json:"total_reactions"`
+	Total_Actions      int  `yaml:"total_actions" json:"total_actions"`
+	Total_Implements   int  `yaml:"total_implements" json:"total_implements"`
+}
+
+// Where an operation was defined. Line is 0 if it couldn't be found.
+type Location struct {
+	File string
+	Line int
+}
+
+func (loc Location) String() string {
+	if loc.File == "" {
+		return "unknown source"
+	}
+	if loc.Line == 0 {
+		return loc.File
+	}
+	return fmt.Sprintf("%s:%d", loc.File, loc.Line)
+}
+
+// Tracks where everything in an Operations struct came from, and the hash
+// keys (see Operation.HashKeys) of everything merged so far, so that
+// conflicts between sources can be found and reported
+type Provenance struct {
+	Observations map[string]Location
+	Reactions    map[string]Location
+	Actions      map[string]Location
+	Implements   map[string]Location
+	Vars         map[string]Location
+	Hashes       map[string]string
+}
+
+func NewProvenance() *Provenance {
+	return &Provenance{
+		Observations: make(map[string]Location),
+		Reactions:    make(map[string]Location),
+		Actions:      make(map[string]Location),
+		Implements:   make(map[string]Location),
+		Vars:         make(map[string]Location),
+		Hashes:       make(map[string]string),
+	}
 }
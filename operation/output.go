@@ -0,0 +1,45 @@
+package operation
+
+import (
+	"strings"
+
+	"github.com/puppetlabs/regulator/sanitize"
+)
+
+// How the output of an implement or action is cleaned up before it's used.
+// Observations compare the cleaned up result with their expect, so the
+// mode decides what an expect has to look like:
+//
+//	raw:          exactly what was printed, a trailing newline included,
+//	              so a multi-line expect (e.g. a yaml '|' block) can match
+//	trimmed:      leading and trailing whitespace removed, newlines inside
+//	              are kept
+//	single_line:  every newline removed, joining the lines together. The
+//	              default, since it's how output has always been handled
+//
+// Implements can also use 'output: json' (IMPLEMENT_OUTPUT_JSON), which
+// parses the raw output.
+var OUTPUT_RAW string = "raw"
+var OUTPUT_TRIMMED string = "trimmed"
+var OUTPUT_SINGLE_LINE string = "single_line"
+
+var OUTPUT_MODES []string = []string{OUTPUT_RAW, OUTPUT_TRIMMED, OUTPUT_SINGLE_LINE}
+
+// Cleans up output for a mode, anything that isn't raw or trimmed
+// (including json, which is parsed separately) is made a single line
+func CleanOutput(mode string, output string) string {
+	switch mode {
+	case OUTPUT_RAW:
+		return output
+	case OUTPUT_TRIMMED:
+		return strings.TrimSpace(output)
+	default:
+		return sanitize.ReplaceAllNewlines(output)
+	}
+}
+
+// Logs are only ever read by people, so they keep their newlines whatever
+// the output mode is
+func CleanLogs(logs string) string {
+	return strings.TrimRight(logs, "\r\n")
+}
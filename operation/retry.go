@@ -0,0 +1,25 @@
+package operation
+
+// How many times to try running an observation or action again when it
+// fails, and how long to wait in between, e.g.:
+//
+//	retries: 3
+//	retry_delay: 2s
+//	backoff: 2
+//
+// would try up to 4 times, waiting 2s, then 4s, then 8s. Without a backoff
+// the delay stays the same every time.
+//
+// Something that was killed for running past its timeout isn't tried
+// again unless retry_on_timeout is set, a command that hangs would most
+// likely just hang again, taking the whole timeout every time.
+type Retry struct {
+	Retries          int     `yaml:"retries,omitempty" json:"retries,omitempty"`
+	Retry_Delay      string  `yaml:"retry_delay,omitempty" json:"retry_delay,omitempty"`
+	Backoff          float64 `yaml:"backoff,omitempty" json:"backoff,omitempty"`
+	Retry_On_Timeout bool    `yaml:"retry_on_timeout,omitempty" json:"retry_on_timeout,omitempty"`
+}
+
+func (retry Retry) IsSet() bool {
+	return retry.Retries != 0 || retry.Retry_Delay != "" || retry.Backoff != 0 || retry.Retry_On_Timeout
+}
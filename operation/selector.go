@@ -0,0 +1,60 @@
+package operation
+
+import (
+	"path"
+)
+
+// Picks out the operations in a spec to work with, from the --only,
+// --skip, and --tags flags. Only and Skip are names or globs (see
+// path.Match), e.g. "gcloud *". An operation is selected if:
+//
+//   - it matches one of Only, or Only is empty
+//   - it has one of Tags, or Tags is empty
+//   - it doesn't match any of Skip
+//
+// The zero value selects everything.
+type Selector struct {
+	Only []string
+	Skip []string
+	Tags []string
+}
+
+func (selector Selector) IsSet() bool {
+	return len(selector.Only) > 0 || len(selector.Skip) > 0 || len(selector.Tags) > 0
+}
+
+// Patterns are checked when the selector is built (see
+// operparse.CheckSelector), so a bad one just never matches here
+func (selector Selector) Selects(name string, tags []string) bool {
+	if len(selector.Only) > 0 && !matchesAny(selector.Only, name) {
+		return false
+	}
+	if len(selector.Tags) > 0 && !hasAnyTag(selector.Tags, tags) {
+		return false
+	}
+	return !selector.Skips(name)
+}
+
+func (selector Selector) Skips(name string) bool {
+	return matchesAny(selector.Skip, name)
+}
+
+func matchesAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matched, err := path.Match(pattern, name); err == nil && matched {
+			return true
+		}
+	}
+	return false
+}
+
+func hasAnyTag(wanted []string, tags []string) bool {
+	for _, wanted_tag := range wanted {
+		for _, tag := range tags {
+			if tag == wanted_tag {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,197 @@
+package operparse
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/puppetlabs/regulator/operation"
+	"github.com/puppetlabs/regulator/rgerror"
+)
+
+// Condition values come straight out of the yaml, so they can be any of
+// strings, ints, floats, bools or lists of those. These helpers coerce
+// them to what each check type needs.
+func conditionString(value interface{}) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case int, int64, float64, bool:
+		return fmt.Sprint(v), true
+	default:
+		return "", false
+	}
+}
+
+func conditionNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	case string:
+		number, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if err != nil {
+			return 0, false
+		}
+		return number, true
+	default:
+		return 0, false
+	}
+}
+
+func conditionList(value interface{}) ([]string, bool) {
+	raw_list, ok := value.([]interface{})
+	if !ok {
+		return nil, false
+	}
+	list := []string{}
+	for _, raw_item := range raw_list {
+		item, ok := conditionString(raw_item)
+		if !ok {
+			return nil, false
+		}
+		list = append(list, item)
+	}
+	return list, true
+}
+
+func conditionRange(value interface{}) (float64, float64, bool) {
+	raw_list, ok := value.([]interface{})
+	if !ok || len(raw_list) != 2 {
+		return 0, 0, false
+	}
+	low, low_ok := conditionNumber(raw_list[0])
+	high, high_ok := conditionNumber(raw_list[1])
+	if !low_ok || !high_ok || low > high {
+		return 0, 0, false
+	}
+	return low, high, true
+}
+
+// Checks that a condition's value makes sense for its check type. This
+// runs at parse time so that a bad regex or threshold is caught before
+// anything gets observed or reacted to.
+func ValidateCondition(rctn_name string, cond operation.Condition) *rgerror.RGerror {
+	invalid := func(expected string) *rgerror.RGerror {
+		return &rgerror.RGerror{
+			Kind:    rgerror.InvalidInput,
+			Message: fmt.Sprintf("Reaction '%s' has an invalid condition, check '%s' requires %s, given '%v'", rctn_name, cond.Check, expected, cond.Value),
+			Origin:  nil,
+		}
+	}
+	switch cond.Check {
+	case "matches", "not_matches", "contains":
+		if _, ok := conditionString(cond.Value); !ok {
+			return invalid("a string value")
+		}
+	case "expected":
+		if _, ok := cond.Value.(bool); !ok {
+			return invalid("a value of true or false")
+		}
+	case "regex":
+		pattern, ok := cond.Value.(string)
+		if !ok {
+			return invalid("a regular expression")
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			return &rgerror.RGerror{
+				Kind:    rgerror.InvalidInput,
+				Message: fmt.Sprintf("Reaction '%s' has an invalid condition, '%s' is not a valid regular expression: %s", rctn_name, pattern, err),
+				Origin:  err,
+			}
+		}
+	case "in":
+		if _, ok := conditionList(cond.Value); !ok {
+			return invalid("a list of values")
+		}
+	case "gt", "gte", "lt", "lte":
+		if _, ok := conditionNumber(cond.Value); !ok {
+			return invalid("a number")
+		}
+	case "between":
+		if _, _, ok := conditionRange(cond.Value); !ok {
+			return invalid("a list of two numbers, lowest first")
+		}
+	default:
+		return &rgerror.RGerror{
+			Kind:    rgerror.InvalidInput,
+			Message: fmt.Sprintf("Reaction '%s' has an unknown condition check type '%s'", rctn_name, cond.Check),
+			Origin:  nil,
+		}
+	}
+	return nil
+}
+
+// Evaluates a condition against an observation result. Returns whether the
+// reaction should run and, if it shouldn't, a message explaining why it was
+// skipped.
+//
+// Conditions are validated by ValidateCondition when the spec is parsed, so
+// the only run time failure is a numeric check against a result that isn't
+// a number.
+func EvaluateCondition(cond operation.Condition, obsv_result operation.ObservationResult) (bool, string, *rgerror.RGerror) {
+	result := obsv_result.Result
+	switch cond.Check {
+	case "matches":
+		value, _ := conditionString(cond.Value)
+		return result == value, "Skipped reaction: observation output did not match", nil
+	case "not_matches":
+		value, _ := conditionString(cond.Value)
+		return result != value, "Skipped reaction: observation output matched", nil
+	case "contains":
+		value, _ := conditionString(cond.Value)
+		return strings.Contains(result, value), "Skipped reaction: observation output did not contain '" + value + "'", nil
+	case "expected":
+		if cond.Value == true {
+			return cond.Value == obsv_result.Expected, "Skipped reaction: observation was not the expected result", nil
+		}
+		return cond.Value == obsv_result.Expected, "Skipped reaction: observation was the expected result", nil
+	case "regex":
+		matcher := regexp.MustCompile(cond.Value.(string))
+		return matcher.MatchString(result), "Skipped reaction: observation output did not match regex", nil
+	case "in":
+		values, _ := conditionList(cond.Value)
+		for _, value := range values {
+			if result == value {
+				return true, "", nil
+			}
+		}
+		return false, "Skipped reaction: observation output was not in the list of values", nil
+	}
+
+	number, ok := conditionNumber(result)
+	if !ok {
+		return false, "", &rgerror.RGerror{
+			Kind:    rgerror.InvalidInput,
+			Message: fmt.Sprintf("Error checking condition, check '%s' requires a numeric observation result, given '%s'", cond.Check, result),
+			Origin:  nil,
+		}
+	}
+	skip_msg := fmt.Sprintf("Skipped reaction: observation result %s did not satisfy '%s' %v", result, cond.Check, cond.Value)
+	switch cond.Check {
+	case "gt":
+		threshold, _ := conditionNumber(cond.Value)
+		return number > threshold, skip_msg, nil
+	case "gte":
+		threshold, _ := conditionNumber(cond.Value)
+		return number >= threshold, skip_msg, nil
+	case "lt":
+		threshold, _ := conditionNumber(cond.Value)
+		return number < threshold, skip_msg, nil
+	case "lte":
+		threshold, _ := conditionNumber(cond.Value)
+		return number <= threshold, skip_msg, nil
+	case "between":
+		low, high, _ := conditionRange(cond.Value)
+		return number >= low && number <= high, skip_msg, nil
+	}
+	return false, "", &rgerror.RGerror{
+		Kind:    rgerror.InvalidInput,
+		Message: "Error checking condition, unknown Check type '" + cond.Check + "'",
+		Origin:  nil,
+	}
+}
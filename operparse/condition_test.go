@@ -0,0 +1,131 @@
+package operparse
+
+import (
+	"testing"
+
+	"github.com/puppetlabs/regulator/operation"
+	"gopkg.in/yaml.v2"
+)
+
+// Condition values are whatever the yaml decodes them to, so they're
+// written here as yaml to get the same types a spec would
+func yamlValue(t *testing.T, raw string) interface{} {
+	t.Helper()
+	var value interface{}
+	if err := yaml.Unmarshal([]byte(raw), &value); err != nil {
+		t.Fatalf("bad test value %q: %s", raw, err)
+	}
+	return value
+}
+
+func TestValidateCondition(t *testing.T) {
+	tests := []struct {
+		check string
+		value string
+		valid bool
+	}{
+		{"matches", "RUNNING", true},
+		{"matches", "3", true},
+		{"matches", "[a, b]", false},
+		{"not_matches", "true", true},
+		{"contains", "RUN", true},
+		{"expected", "true", true},
+		{"expected", "'true'", false},
+		{"regex", "^RUN", true},
+		{"regex", "'['", false},
+		{"regex", "3", false},
+		{"in", "[RUNNING, 3, true]", true},
+		{"in", "RUNNING", false},
+		{"in", "[[a]]", false},
+		{"gt", "3", true},
+		{"gte", "'2.5'", true},
+		{"lt", "abc", false},
+		{"lte", "[1]", false},
+		{"between", "[1, 5]", true},
+		{"between", "['1', 5.5]", true},
+		{"between", "[5, 1]", false},
+		{"between", "[1]", false},
+		{"between", "[1, a]", false},
+		{"equals", "x", false},
+	}
+	for _, test := range tests {
+		t.Run(test.check+" "+test.value, func(t *testing.T) {
+			cond := operation.Condition{Check: test.check, Value: yamlValue(t, test.value)}
+			rgerr := ValidateCondition("test", cond)
+			if test.valid && rgerr != nil {
+				t.Errorf("expected valid, got: %s", rgerr.Message)
+			}
+			if !test.valid && rgerr == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
+
+func TestEvaluateCondition(t *testing.T) {
+	tests := []struct {
+		check    string
+		value    string
+		result   string
+		expected bool
+		should   bool
+	}{
+		{"matches", "RUNNING", "RUNNING", false, true},
+		{"matches", "RUNNING", "STOPPED", false, false},
+		{"matches", "3", "3", false, true},
+		{"not_matches", "RUNNING", "STOPPED", false, true},
+		{"contains", "UNN", "RUNNING", false, true},
+		{"contains", "x", "RUNNING", false, false},
+		{"expected", "true", "", true, true},
+		{"expected", "true", "", false, false},
+		{"expected", "false", "", false, true},
+		{"regex", "^RUN", "RUNNING", false, true},
+		{"regex", "^RUN", "STOPPED", false, false},
+		{"in", "[RUNNING, STAGING]", "STAGING", false, true},
+		{"in", "[1, 2]", "2", false, true},
+		{"in", "[RUNNING]", "STOPPED", false, false},
+		{"gt", "3", "4", false, true},
+		{"gt", "3", "3", false, false},
+		{"gte", "3", " 3 ", false, true},
+		{"lt", "'2.5'", "2", false, true},
+		{"lte", "2", "2.1", false, false},
+		{"between", "[1, 5]", "5", false, true},
+		{"between", "[1, 5]", "0", false, false},
+	}
+	for _, test := range tests {
+		t.Run(test.check+" "+test.value+" "+test.result, func(t *testing.T) {
+			cond := operation.Condition{Check: test.check, Value: yamlValue(t, test.value)}
+			if rgerr := ValidateCondition("test", cond); rgerr != nil {
+				t.Fatalf("bad test condition: %s", rgerr.Message)
+			}
+			obsv_result := operation.ObservationResult{Succeeded: true, Result: test.result, Expected: test.expected}
+			should_run, skip_msg, rgerr := EvaluateCondition(cond, obsv_result)
+			if rgerr != nil {
+				t.Fatalf("unexpected error: %s", rgerr.Message)
+			}
+			if should_run != test.should {
+				t.Errorf("got %t, want %t", should_run, test.should)
+			}
+			if !should_run && skip_msg == "" {
+				t.Errorf("skipped without a message")
+			}
+		})
+	}
+}
+
+func TestEvaluateConditionNotANumber(t *testing.T) {
+	for _, check := range []string{"gt", "gte", "lt", "lte", "between"} {
+		t.Run(check, func(t *testing.T) {
+			value := yamlValue(t, "3")
+			if check == "between" {
+				value = yamlValue(t, "[1, 3]")
+			}
+			cond := operation.Condition{Check: check, Value: value}
+			obsv_result := operation.ObservationResult{Succeeded: true, Result: "RUNNING"}
+			should_run, _, rgerr := EvaluateCondition(cond, obsv_result)
+			if rgerr == nil || should_run {
+				t.Errorf("expected an error for a non numeric result")
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package operparse
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/puppetlabs/regulator/operation"
+	"github.com/puppetlabs/regulator/rgerror"
+)
+
+// Checks that everything a spec refers to by name actually exists, without
+// running anything. Without this, broken references only show up at run
+// time as skipped reactions ("action not found" and friends).
+//
+// Every problem found is a finding in the returned ValidationError.
+func CheckReferences(data *operation.Operations) *rgerror.RGerror {
+	var findings []rgerror.Finding
+	prov := data.Provenance
+	if prov == nil {
+		prov = operation.NewProvenance()
+	}
+
+	// Sorted so findings on the same line (or without one) always come
+	// out in the same order
+	obsv_names := make([]string, 0, len(data.Observations))
+	for obsv_name := range data.Observations {
+		obsv_names = append(obsv_names, obsv_name)
+	}
+	sort.Strings(obsv_names)
+	for _, obsv_name := range obsv_names {
+		obsv := data.Observations[obsv_name]
+		impl_name, impl := SelectObservingImplement(obsv, data.Implements)
+		if impl == nil {
+			findings = append(findings, newFinding("missing_implement", "observation", obsv_name, prov.Observations[obsv_name], fmt.Sprintf(
+				"Observation '%s' has no implement that observes entity '%s' query '%s'",
+				obsv_name,
+				obsv.Entity,
+				obsv.Query,
+			)))
+			continue
+		}
+		if obsv.Expect_Path != "" && impl.Output != operation.IMPLEMENT_OUTPUT_JSON {
+			findings = append(findings, newFinding("invalid", "observation", obsv_name, prov.Observations[obsv_name], fmt.Sprintf(
+				"Observation '%s' has an expect_path but its implement '%s' does not have 'output: json'",
+				obsv_name,
+				impl_name,
+			)))
+		}
+	}
+
+	rctn_names := make([]string, 0, len(data.Reactions))
+	for rctn_name := range data.Reactions {
+		rctn_names = append(rctn_names, rctn_name)
+	}
+	sort.Strings(rctn_names)
+	for _, rctn_name := range rctn_names {
+		rctn := data.Reactions[rctn_name]
+		loc := prov.Reactions[rctn_name]
+		var obsv *operation.Observation
+		if rctn.Observation != "" {
+			obsv = SelectObservation(rctn.Observation, data.Observations)
+			if obsv == nil {
+				findings = append(findings, newFinding("unknown_reference", "reaction", rctn_name, loc, fmt.Sprintf(
+					"Reaction '%s' reacts to '%s', which is not a known observation",
+					rctn_name,
+					rctn.Observation,
+				)))
+			}
+		}
+		if rctn.Action == "correction" {
+			// A missing observation was already reported above
+			if obsv == nil {
+				continue
+			}
+			if !obsv.Expect.IsSet() {
+				findings = append(findings, newFinding("no_correction", "reaction", rctn_name, loc, fmt.Sprintf(
+					"Reaction '%s' is a correction but observation '%s' doesn't expect anything to correct to",
+					rctn_name,
+					rctn.Observation,
+				)))
+			} else if !canBeCorrected(*obsv, data.Implements) {
+				findings = append(findings, newFinding("no_correction", "reaction", rctn_name, loc, fmt.Sprintf(
+					"Reaction '%s' is a correction but no implement corrects entity '%s' query '%s' to a result that meets the expectation '%s'",
+					rctn_name,
+					obsv.Entity,
+					obsv.Query,
+					obsv.Expect,
+				)))
+			}
+			continue
+		}
+		if SelectAction(rctn.Action, data.Actions) == nil && SelectImplementActionByName(rctn.Action, data.Implements) == nil {
+			findings = append(findings, newFinding("unknown_reference", "reaction", rctn_name, loc, fmt.Sprintf(
+				"Reaction '%s' runs '%s', which is not a known action, implement, or 'correction'",
+				rctn_name,
+				rctn.Action,
+			)))
+		}
+	}
+
+	if len(findings) > 0 {
+		return rgerror.NewValidationError(findings)
+	}
+	return nil
+}
+
+// The implement that runs an observation, there can only be one for an
+// entity/query since ConcatOperations rejects duplicates
+func SelectObservingImplement(obsv operation.Observation, impls map[string]operation.Implement) (string, *operation.Implement) {
+	for impl_name, impl := range impls {
+		if impl.Observes.Entity == obsv.Entity && impl.Observes.Query == obsv.Query {
+			return impl_name, &impl
+		}
+	}
+	return "", nil
+}
+
+// Whether any implement could correct the observation from at least one
+// starting state. Which state the entity is actually in is only known at
+// run time.
+func canBeCorrected(obsv operation.Observation, impls map[string]operation.Implement) bool {
+	for _, impl := range impls {
+		if impl.Reacts.Corrects.Entity == obsv.Entity &&
+			impl.Reacts.Corrects.Query == obsv.Query &&
+			len(impl.Reacts.Corrects.Starts_From) > 0 &&
+			obsv.Expect.Matches(impl.Reacts.Corrects.Results_In) {
+			return true
+		}
+	}
+	return false
+}
@@ -2,39 +2,162 @@ package operparse
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/puppetlabs/regulator/expression"
 	"github.com/puppetlabs/regulator/operation"
 	"github.com/puppetlabs/regulator/rgerror"
-	"gopkg.in/yaml.v2"
 )
 
 var RESERVED_INSTANCE_NAME string = "__obsv_instance__"
 
+// The noop protocol. Regulator asks an action or implement to only report
+// what it would change in two ways, so implements can use whichever is
+// easier for them:
+//   - __noop__ in args is replaced with NOOP_ARG_VALUE ("noop"), or with
+//     RUN_ARG_VALUE ("run") when running for real
+//   - NOOP_ENV_VAR is set to "true" in the environment, or to "false"
+//     when running for real
+//
+// In noop mode the implement must not change anything, and must print
+// either NOOP_WOULD_CHANGE or NOOP_NO_CHANGE on stdout.
+var RESERVED_NOOP_NAME string = "__noop__"
+var NOOP_ARG_VALUE string = "noop"
+var RUN_ARG_VALUE string = "run"
+var NOOP_ENV_VAR string = "REGULATOR_NOOP"
+var NOOP_WOULD_CHANGE string = "would_change"
+var NOOP_NO_CHANGE string = "no_change"
+
+// What action names can be made of. They end up on the remote regulator's
+// command line for 'run remote', so anything else a shell treats
+// specially is left out.
+var ACTION_NAME_PATTERN string = `[A-Za-z0-9 _.:@/+,=-]+`
+var action_name_matcher *regexp.Regexp = regexp.MustCompile(`^(?:` + ACTION_NAME_PATTERN + `)$`)
+
+// Names 'when' expressions use to refer to observation and reaction
+// results, vars can't use these names
+var WHEN_RESULTS_NAME string = "results"
+var WHEN_OBSERVATIONS_NAME string = "observations"
+var WHEN_REACTIONS_NAME string = "reactions"
+
 // Idempotent function for merging new data in to Operations
 // struct. Can be used more than once to read data from multiple
-// sources
+// sources. Any includes in raw_data are relative to the working
+// directory, use LoadSpecs to load files with includes relative
+// to the file.
+//
+// A reaction can depend on one from a later source, so the reaction graph
+// isn't checked here. Call CheckReactionGraph once everything is merged
+// (LoadSpecs does), or it's only caught when reacting.
 func ParseOperations(raw_data []byte, data *operation.Operations) *rgerror.RGerror {
-	unmarshald_data := operation.Operations{}
-	err := yaml.UnmarshalStrict(raw_data, &unmarshald_data)
+	cwd, err := os.Getwd()
 	if err != nil {
 		return &rgerror.RGerror{
 			Kind:    rgerror.ExecError,
-			Message: fmt.Sprintf("Failed to parse yaml:\n%s", err),
+			Message: "Failed to find the working directory to resolve includes",
 			Origin:  err,
 		}
 	}
-	rgerr := ConcatOperations(data, &unmarshald_data)
+	loader := newSpecLoader(data)
+	rgerr := loader.loadRaw(raw_data, "input", cwd)
 	if rgerr != nil {
 		return rgerr
 	}
+	return loader.report()
+}
+
+// yaml decodes nested maps as map[interface{}]interface{}, which can't be
+// rendered as JSON, so vars are converted to map[string]interface{} as
+// they are merged
+func normalizeYamlValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		normalized := make(map[string]interface{})
+		for key, item := range v {
+			normalized[fmt.Sprint(key)] = normalizeYamlValue(item)
+		}
+		return normalized
+	case []interface{}:
+		normalized := make([]interface{}, len(v))
+		for index, item := range v {
+			normalized[index] = normalizeYamlValue(item)
+		}
+		return normalized
+	default:
+		return value
+	}
+}
+
+func newFinding(kind string, operation_type string, name string, loc operation.Location, message string) rgerror.Finding {
+	return rgerror.Finding{
+		Kind:           kind,
+		Operation_Type: operation_type,
+		Operation:      name,
+		File:           loc.File,
+		Line:           loc.Line,
+		Message:        message,
+	}
+}
+
+// Returns a finding if name is already defined in an earlier source and the
+// new definition doesn't set override
+func checkRedefinition(operation_type string, name string, already_defined bool, override bool, first_loc operation.Location, second_loc operation.Location) *rgerror.Finding {
+	if already_defined && !override {
+		finding := newFinding("redefined", operation_type, name, second_loc, fmt.Sprintf(
+			"%s '%s' is already defined in %s, set 'override: true' to replace it",
+			strings.ToUpper(operation_type[:1])+operation_type[1:], name, first_loc,
+		))
+		return &finding
+	}
 	return nil
 }
 
+// When a definition is overridden the hash keys of the definition it
+// replaces shouldn't be able to conflict with anything anymore
+func forgetHashes(hashes map[string]string, name string, keys []string) {
+	for _, key := range keys {
+		if hashes[key] == name {
+			delete(hashes, key)
+		}
+	}
+}
+
+// Only called once an operation is known not to conflict, so that
+// operations with problems never end up in the conflicts map
+func registerHashes(hashes map[string]string, name string, keys []string) {
+	for _, key := range keys {
+		if _, taken := hashes[key]; !taken {
+			hashes[key] = name
+		}
+	}
+}
+
 // Yeah this is big and ugly and could probably have helper functions,
 // but I don't want to do that much interface magic and pass enough
 // strings around to make the messages different and helpful.
+//
+// Conflicts are checked against everything merged in to first so far, not
+// just against second. Rather than stopping at the first problem every
+// problem is collected and returned together as a ValidationError, so a
+// broken spec can be fixed in one go. Operations with problems are not
+// merged in to first.
 func ConcatOperations(first *operation.Operations, second *operation.Operations) *rgerror.RGerror {
-	var conflicts map[string]string = make(map[string]string)
+	var findings []rgerror.Finding
+	if first.Provenance == nil {
+		first.Provenance = operation.NewProvenance()
+	}
+	second_prov := second.Provenance
+	if second_prov == nil {
+		second_prov = operation.NewProvenance()
+	}
+	first_prov := first.Provenance
+	conflicts := first_prov.Hashes
 	if first.Observations == nil {
 		first.Observations = make(map[string]operation.Observation)
 	}
@@ -47,14 +170,70 @@ func ConcatOperations(first *operation.Operations, second *operation.Operations)
 	if first.Implements == nil {
 		first.Implements = make(map[string]operation.Implement)
 	}
+	if first.Vars == nil {
+		first.Vars = make(map[string]interface{})
+	}
+	for var_name, raw_value := range second.Vars {
+		var_value := normalizeYamlValue(raw_value)
+		var_loc := second_prov.Vars[var_name]
+		if var_name == WHEN_RESULTS_NAME || var_name == WHEN_OBSERVATIONS_NAME || var_name == WHEN_REACTIONS_NAME {
+			findings = append(findings, newFinding("reserved", "var", var_name, var_loc, fmt.Sprintf(
+				"Var '%s' uses a reserved name, vars cannot be named '%s', '%s', or '%s'",
+				var_name, WHEN_RESULTS_NAME, WHEN_OBSERVATIONS_NAME, WHEN_REACTIONS_NAME,
+			)))
+			continue
+		}
+		if existing, found := first.Vars[var_name]; found && !reflect.DeepEqual(existing, var_value) {
+			findings = append(findings, newFinding("conflict", "var", var_name, var_loc, fmt.Sprintf(
+				"Var '%s' is already set to a different value in %s",
+				var_name, first_prov.Vars[var_name],
+			)))
+			continue
+		}
+		first.Vars[var_name] = var_value
+		first_prov.Vars[var_name] = var_loc
+	}
 	for obsv_name, obsv := range second.Observations {
+		obsv_loc := second_prov.Observations[obsv_name]
 		if obsv.Empty() {
-			return &rgerror.RGerror{
-				Kind:    rgerror.InvalidInput,
-				Message: fmt.Sprintf("Observation '%s' is empty, observations must have all of 'entity', 'query', and 'instance' set", obsv_name),
-				Origin:  nil,
+			findings = append(findings, newFinding("empty", "observation", obsv_name, obsv_loc, fmt.Sprintf(
+				"Observation '%s' is empty, observations must have all of 'entity', 'query', and 'instance' set",
+				obsv_name,
+			)))
+			continue
+		}
+		if err := obsv.Expect.Validate(); err != nil {
+			findings = append(findings, newFinding("invalid", "observation", obsv_name, obsv_loc, fmt.Sprintf(
+				"Observation '%s' has an invalid 'expect': %s",
+				obsv_name, err,
+			)))
+			continue
+		}
+		if _, err := ParseRetryDelay(obsv.Retry); err != nil {
+			findings = append(findings, newFinding("invalid", "observation", obsv_name, obsv_loc, fmt.Sprintf(
+				"Observation '%s' has invalid retry settings: %s",
+				obsv_name, err,
+			)))
+			continue
+		}
+		if obsv.Expect_Path != "" {
+			if _, rgerr := expression.ParsePath(obsv.Expect_Path); rgerr != nil {
+				findings = append(findings, newFinding("invalid", "observation", obsv_name, obsv_loc, fmt.Sprintf(
+					"Observation '%s' has an invalid 'expect_path': %s",
+					obsv_name, rgerr.Message,
+				)))
+				continue
 			}
 		}
+		existing, already_defined := first.Observations[obsv_name]
+		if finding := checkRedefinition("observation", obsv_name, already_defined, obsv.Override, first_prov.Observations[obsv_name], obsv_loc); finding != nil {
+			findings = append(findings, *finding)
+			continue
+		}
+		if already_defined {
+			forgetHashes(conflicts, obsv_name, existing.HashKeys())
+		}
+		conflicted_with := ""
 		for _, key := range obsv.HashKeys() {
 			if conflict, conflicted := conflicts[key]; conflicted == true {
 				// When observations have a collision that's not necessarily
@@ -64,93 +243,341 @@ func ConcatOperations(first *operation.Operations, second *operation.Operations)
 				// it's fine. In the case where they are the same we don't need to
 				// add this latest observation to the conflicts map because
 				// there's already a matching hash there
-				if first.Observations[conflict].Expect != obsv.Expect {
-					return &rgerror.RGerror{
-						Kind:    rgerror.InvalidInput,
-						Message: fmt.Sprintf("Observation '%s' conflicts with '%s'", obsv_name, conflict),
-						Origin:  nil,
-					}
+				if !first.Observations[conflict].Expect.Equal(obsv.Expect) {
+					conflicted_with = conflict
 				}
-			} else {
-				conflicts[key] = obsv_name
 			}
 		}
+		if conflicted_with != "" {
+			findings = append(findings, newFinding("conflict", "observation", obsv_name, obsv_loc, fmt.Sprintf(
+				"Observation '%s' conflicts with '%s' in %s",
+				obsv_name, conflicted_with, first_prov.Observations[conflicted_with],
+			)))
+			continue
+		}
+		registerHashes(conflicts, obsv_name, obsv.HashKeys())
 		first.Observations[obsv_name] = obsv
+		first_prov.Observations[obsv_name] = obsv_loc
 	}
 	for rctn_name, rctn := range second.Reactions {
+		rctn_loc := second_prov.Reactions[rctn_name]
 		if rctn.Empty() {
-			return &rgerror.RGerror{
-				Kind:    rgerror.InvalidInput,
-				Message: fmt.Sprintf("Reaction '%s' is empty, reactions must have all of 'observation', 'action', and 'condition check/value' set", rctn_name),
-				Origin:  nil,
+			findings = append(findings, newFinding("empty", "reaction", rctn_name, rctn_loc, fmt.Sprintf(
+				"Reaction '%s' is empty, reactions must have 'action' set and either all of 'observation' and 'condition check/value' or a 'when' expression (corrections always need an 'observation')",
+				rctn_name,
+			)))
+			continue
+		}
+		// Reactions with a 'when' expression don't have to have a condition
+		if rctn.Condition.Check != "" || rctn.When == "" {
+			if rgerr := ValidateCondition(rctn_name, rctn.Condition); rgerr != nil {
+				findings = append(findings, newFinding("invalid", "reaction", rctn_name, rctn_loc, rgerr.Message))
+				continue
+			}
+		}
+		if rctn.When != "" {
+			if _, rgerr := expression.Parse(rctn.When); rgerr != nil {
+				findings = append(findings, newFinding("invalid", "reaction", rctn_name, rctn_loc, fmt.Sprintf(
+					"Reaction '%s' has an invalid 'when' expression: %s",
+					rctn_name, rgerr.Message,
+				)))
+				continue
 			}
 		}
+		existing, already_defined := first.Reactions[rctn_name]
+		if finding := checkRedefinition("reaction", rctn_name, already_defined, rctn.Override, first_prov.Reactions[rctn_name], rctn_loc); finding != nil {
+			findings = append(findings, *finding)
+			continue
+		}
+		if already_defined {
+			forgetHashes(conflicts, rctn_name, existing.HashKeys())
+		}
+		conflicted_with := ""
 		for _, key := range rctn.HashKeys() {
 			if conflict, conflicted := conflicts[key]; conflicted == true {
-				return &rgerror.RGerror{
-					Kind:    rgerror.InvalidInput,
-					Message: fmt.Sprintf("Reaction '%s' conflicts with '%s'", rctn_name, conflict),
-					Origin:  nil,
-				}
-			} else {
-				conflicts[key] = rctn_name
+				conflicted_with = conflict
 			}
 		}
+		if conflicted_with != "" {
+			findings = append(findings, newFinding("conflict", "reaction", rctn_name, rctn_loc, fmt.Sprintf(
+				"Reaction '%s' conflicts with '%s' in %s",
+				rctn_name, conflicted_with, first_prov.Reactions[conflicted_with],
+			)))
+			continue
+		}
+		registerHashes(conflicts, rctn_name, rctn.HashKeys())
 		first.Reactions[rctn_name] = rctn
+		first_prov.Reactions[rctn_name] = rctn_loc
 	}
 	for actn_name, actn := range second.Actions {
+		actn_loc := second_prov.Actions[actn_name]
 		if actn.Empty() {
-			return &rgerror.RGerror{
-				Kind:    rgerror.InvalidInput,
-				Message: fmt.Sprintf("Action '%s' is empty, actions must have 'exe' and one of 'path' or 'script' set", actn_name),
-				Origin:  nil,
-			}
+			findings = append(findings, newFinding("empty", "action", actn_name, actn_loc, fmt.Sprintf(
+				"Action '%s' is empty, actions must have 'exe' and one of 'path' or 'script' set",
+				actn_name,
+			)))
+			continue
+		}
+		if !action_name_matcher.MatchString(actn_name) {
+			findings = append(findings, newFinding("invalid", "action", actn_name, actn_loc, fmt.Sprintf(
+				"Action '%s' has an invalid name, action names can only use letters, digits, spaces, and '_.:@/+,=-'",
+				actn_name,
+			)))
+			continue
+		}
+		if !validOutputMode(actn.Output) {
+			findings = append(findings, newFinding("invalid", "action", actn_name, actn_loc, fmt.Sprintf(
+				"Action '%s' has unknown output type '%s', output must be one of '%s' or not set",
+				actn_name, actn.Output, strings.Join(operation.OUTPUT_MODES, "', '"),
+			)))
+			continue
+		}
+		if _, err := ParseTimeout(actn.Timeout); err != nil {
+			findings = append(findings, newFinding("invalid", "action", actn_name, actn_loc, fmt.Sprintf(
+				"Action '%s' has an invalid 'timeout': %s",
+				actn_name, err,
+			)))
+			continue
+		}
+		if _, err := ParseRetryDelay(actn.Retry); err != nil {
+			findings = append(findings, newFinding("invalid", "action", actn_name, actn_loc, fmt.Sprintf(
+				"Action '%s' has invalid retry settings: %s",
+				actn_name, err,
+			)))
+			continue
+		}
+		if err := CheckEnvironment(actn.Environment); err != nil {
+			findings = append(findings, newFinding("invalid", "action", actn_name, actn_loc, fmt.Sprintf(
+				"Action '%s' has an invalid environment: %s",
+				actn_name, err,
+			)))
+			continue
+		}
+		if err := CheckBecome(actn.Become); err != nil {
+			findings = append(findings, newFinding("invalid", "action", actn_name, actn_loc, fmt.Sprintf(
+				"Action '%s' has invalid become settings: %s",
+				actn_name, err,
+			)))
+			continue
+		}
+		existing, already_defined := first.Actions[actn_name]
+		if finding := checkRedefinition("action", actn_name, already_defined, actn.Override, first_prov.Actions[actn_name], actn_loc); finding != nil {
+			findings = append(findings, *finding)
+			continue
 		}
+		if already_defined {
+			forgetHashes(conflicts, actn_name, existing.HashKeys())
+		}
+		conflicted_with := ""
 		for _, key := range actn.HashKeys() {
 			if conflict, conflicted := conflicts[key]; conflicted == true {
-				return &rgerror.RGerror{
-					Kind:    rgerror.InvalidInput,
-					Message: fmt.Sprintf("Action '%s' conflicts with '%s'", actn_name, conflict),
-					Origin:  nil,
-				}
-			} else {
-				conflicts[key] = actn_name
+				conflicted_with = conflict
 			}
 		}
+		if conflicted_with != "" {
+			findings = append(findings, newFinding("conflict", "action", actn_name, actn_loc, fmt.Sprintf(
+				"Action '%s' conflicts with '%s' in %s",
+				actn_name, conflicted_with, first_prov.Actions[conflicted_with],
+			)))
+			continue
+		}
+		registerHashes(conflicts, actn_name, actn.HashKeys())
 		first.Actions[actn_name] = actn
+		first_prov.Actions[actn_name] = actn_loc
 	}
 	for impl_name, impl := range second.Implements {
+		impl_loc := second_prov.Implements[impl_name]
 		if impl.Empty() {
-			return &rgerror.RGerror{
-				Kind:    rgerror.InvalidInput,
-				Message: fmt.Sprintf("Implement '%s' is empty, implements must have 'exe' set, one of 'path' or 'script' set, and either react or observe or both", impl_name),
-				Origin:  nil,
-			}
+			findings = append(findings, newFinding("empty", "implement", impl_name, impl_loc, fmt.Sprintf(
+				"Implement '%s' is empty, implements must have 'exe' set, one of 'path' or 'script' set, and either react or observe or both",
+				impl_name,
+			)))
+			continue
+		}
+		if impl.Output != operation.IMPLEMENT_OUTPUT_JSON && !validOutputMode(impl.Output) {
+			findings = append(findings, newFinding("invalid", "implement", impl_name, impl_loc, fmt.Sprintf(
+				"Implement '%s' has unknown output type '%s', output must be one of '%s', '%s' or not set",
+				impl_name, impl.Output, strings.Join(operation.OUTPUT_MODES, "', '"), operation.IMPLEMENT_OUTPUT_JSON,
+			)))
+			continue
+		}
+		if _, err := ParseTimeout(impl.Timeout); err != nil {
+			findings = append(findings, newFinding("invalid", "implement", impl_name, impl_loc, fmt.Sprintf(
+				"Implement '%s' has an invalid 'timeout': %s",
+				impl_name, err,
+			)))
+			continue
+		}
+		if _, err := ParseRetryDelay(impl.Retry); err != nil {
+			findings = append(findings, newFinding("invalid", "implement", impl_name, impl_loc, fmt.Sprintf(
+				"Implement '%s' has invalid retry settings: %s",
+				impl_name, err,
+			)))
+			continue
+		}
+		if err := CheckEnvironment(impl.Environment); err != nil {
+			findings = append(findings, newFinding("invalid", "implement", impl_name, impl_loc, fmt.Sprintf(
+				"Implement '%s' has an invalid environment: %s",
+				impl_name, err,
+			)))
+			continue
 		}
+		if err := CheckBecome(impl.Become); err != nil {
+			findings = append(findings, newFinding("invalid", "implement", impl_name, impl_loc, fmt.Sprintf(
+				"Implement '%s' has invalid become settings: %s",
+				impl_name, err,
+			)))
+			continue
+		}
+		existing, already_defined := first.Implements[impl_name]
+		if finding := checkRedefinition("implement", impl_name, already_defined, impl.Override, first_prov.Implements[impl_name], impl_loc); finding != nil {
+			findings = append(findings, *finding)
+			continue
+		}
+		if already_defined {
+			forgetHashes(conflicts, impl_name, existing.HashKeys())
+		}
+		conflicted_with := ""
 		for _, key := range impl.HashKeys() {
 			if conflict, conflicted := conflicts[key]; conflicted == true {
-				return &rgerror.RGerror{
-					Kind:    rgerror.InvalidInput,
-					Message: fmt.Sprintf("Implement '%s' conflicts with '%s'", impl_name, conflict),
-					Origin:  nil,
-				}
-			} else {
-				conflicts[key] = impl_name
+				conflicted_with = conflict
 			}
 		}
+		if conflicted_with != "" {
+			findings = append(findings, newFinding("conflict", "implement", impl_name, impl_loc, fmt.Sprintf(
+				"Implement '%s' conflicts with '%s' in %s",
+				impl_name, conflicted_with, first_prov.Implements[conflicted_with],
+			)))
+			continue
+		}
+		registerHashes(conflicts, impl_name, impl.HashKeys())
 		first.Implements[impl_name] = impl
+		first_prov.Implements[impl_name] = impl_loc
+	}
+	if len(findings) > 0 {
+		return rgerror.NewValidationError(findings)
+	}
+	return nil
+}
+
+// Timeouts are Go durations like "30s" or "1m30s", an empty string means
+// there's no timeout
+func ParseTimeout(timeout string) (time.Duration, error) {
+	if timeout == "" {
+		return 0, nil
+	}
+	duration, err := time.ParseDuration(timeout)
+	if err != nil {
+		return 0, fmt.Errorf("'%s' is not a duration like '30s' or '5m'", timeout)
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("'%s' must be longer than 0", timeout)
+	}
+	return duration, nil
+}
+
+// Checks retry settings make sense and returns the delay before the first
+// retry
+func ParseRetryDelay(retry operation.Retry) (time.Duration, error) {
+	if retry.Retries < 0 {
+		return 0, fmt.Errorf("'retries' can't be negative, given %d", retry.Retries)
+	}
+	if retry.Backoff != 0 && retry.Backoff < 1 {
+		return 0, fmt.Errorf("'backoff' multiplies the delay after every retry and must be 1 or more, given %v", retry.Backoff)
+	}
+	if retry.Retry_Delay == "" {
+		return 0, nil
+	}
+	delay, err := time.ParseDuration(retry.Retry_Delay)
+	if err != nil || delay < 0 {
+		return 0, fmt.Errorf("'retry_delay' must be a duration like '500ms' or '2s', given '%s'", retry.Retry_Delay)
+	}
+	return delay, nil
+}
+
+// Checks env, cwd, and keep_env make sense
+func CheckEnvironment(environment operation.Environment) error {
+	for name := range environment.Env {
+		if name == "" || strings.ContainsAny(name, "=\x00") {
+			return fmt.Errorf("'%s' is not a valid environment variable name", name)
+		}
+	}
+	if len(environment.Keep_Env) > 0 && !environment.Clean_Env {
+		return fmt.Errorf("'keep_env' only makes sense with 'clean_env: true', everything is inherited otherwise")
+	}
+	if environment.Cwd != "" && !filepath.IsAbs(environment.Cwd) {
+		return fmt.Errorf("'cwd' must be an absolute path, given '%s'", environment.Cwd)
+	}
+	return nil
+}
+
+func validOutputMode(mode string) bool {
+	if mode == "" {
+		return true
+	}
+	for _, valid_mode := range operation.OUTPUT_MODES {
+		if mode == valid_mode {
+			return true
+		}
+	}
+	return false
+}
+
+// Implements with 'output: json' only parse JSON when observing, their
+// output when reacting is handled the default way
+func reactOutputMode(impl operation.Implement) string {
+	if impl.Output == operation.IMPLEMENT_OUTPUT_JSON {
+		return ""
+	}
+	return impl.Output
+}
+
+// Checks become_user and become_exe are only set along with become
+func CheckBecome(become operation.Become) error {
+	if !become.Become && (become.Become_User != "" || become.Become_Exe != "") {
+		return fmt.Errorf("'become_user' and 'become_exe' do nothing without 'become: true'")
+	}
+	return nil
+}
+
+// Gives every action and implement that doesn't set its own timeout the
+// one passed with --timeout
+func ApplyDefaultTimeout(data *operation.Operations, timeout string) *rgerror.RGerror {
+	if _, err := ParseTimeout(timeout); err != nil {
+		return &rgerror.RGerror{
+			Kind:    rgerror.InvalidInput,
+			Message: fmt.Sprintf("Invalid --timeout: %s", err),
+			Origin:  err,
+		}
+	}
+	if timeout == "" {
+		return nil
+	}
+	for actn_name, actn := range data.Actions {
+		if actn.Timeout == "" {
+			actn.Timeout = timeout
+			data.Actions[actn_name] = actn
+		}
+	}
+	for impl_name, impl := range data.Implements {
+		if impl.Timeout == "" {
+			impl.Timeout = timeout
+			data.Implements[impl_name] = impl
+		}
 	}
 	return nil
 }
 
 // Replaces a special string in a list of arguments (used for observations and
 // reaction impls) with specific data from elsewhere
-func ComputeArgs(arg_spec []string, obsv operation.Observation) []string {
+func ComputeArgs(arg_spec []string, obsv operation.Observation, noop bool) []string {
 	var args []string
 	for _, a := range arg_spec {
 		switch a {
 		case RESERVED_INSTANCE_NAME:
 			args = append(args, obsv.Instance)
+		case RESERVED_NOOP_NAME:
+			args = append(args, noopArgValue(noop))
 		default:
 			args = append(args, a)
 		}
@@ -158,6 +585,65 @@ func ComputeArgs(arg_spec []string, obsv operation.Observation) []string {
 	return args
 }
 
+// Env values are substituted the same way args are. A new map is returned
+// so the spec's own env is left alone.
+func ComputeEnv(env_spec map[string]string, obsv operation.Observation, noop bool) map[string]string {
+	if env_spec == nil {
+		return nil
+	}
+	env := make(map[string]string, len(env_spec))
+	for name, value := range env_spec {
+		env[name] = ComputeArgs([]string{value}, obsv, noop)[0]
+	}
+	return env
+}
+
+// Same as ComputeEnv, for plain actions (see ComputeNoopArgs)
+func ComputeNoopEnv(env_spec map[string]string, noop bool) map[string]string {
+	if env_spec == nil {
+		return nil
+	}
+	env := make(map[string]string, len(env_spec))
+	for name, value := range env_spec {
+		env[name] = ComputeNoopArgs([]string{value}, noop)[0]
+	}
+	return env
+}
+
+// Plain actions don't react to an observation, so only __noop__ is
+// replaced in their args
+func ComputeNoopArgs(arg_spec []string, noop bool) []string {
+	var args []string
+	for _, a := range arg_spec {
+		if a == RESERVED_NOOP_NAME {
+			args = append(args, noopArgValue(noop))
+		} else {
+			args = append(args, a)
+		}
+	}
+	return args
+}
+
+func noopArgValue(noop bool) string {
+	if noop {
+		return NOOP_ARG_VALUE
+	}
+	return RUN_ARG_VALUE
+}
+
+// Actions with __noop__ in their args support noop even if they don't say so
+func SupportsNoop(actn operation.Action) bool {
+	if actn.Supports_Noop {
+		return true
+	}
+	for _, arg := range actn.Args {
+		if arg == RESERVED_NOOP_NAME {
+			return true
+		}
+	}
+	return false
+}
+
 func SelectAction(actn_name string, actns map[string]operation.Action) *operation.Action {
 	if selected_action, found := actns[actn_name]; found {
 		return &selected_action
@@ -182,27 +668,51 @@ func SelectObservationResult(obsv_name string, obsv_results map[string]operation
 func SelectImplementActionByName(impl_name string, impls map[string]operation.Implement) *operation.Action {
 	if selected_impl, found := impls[impl_name]; found {
 		return &operation.Action{
-			Path:   selected_impl.Path,
-			Script: selected_impl.Script,
-			Exe:    selected_impl.Exe,
-			Args:   selected_impl.Reacts.Args,
+			Path:          selected_impl.Path,
+			Script:        selected_impl.Script,
+			Exe:           selected_impl.Exe,
+			Args:          selected_impl.Reacts.Args,
+			Supports_Noop: selected_impl.Reacts.Supports_Noop,
+			Timeout:       selected_impl.Timeout,
+			Output:        reactOutputMode(selected_impl),
+			Retry:         selected_impl.Retry,
+			Environment:   selected_impl.Environment,
+			Become:        selected_impl.Become,
 		}
 	}
 	return nil
 }
 
+// An implement can correct an observation if it corrects the same
+// entity/query, starts from the current result, and results in something
+// the observation's expectation accepts. With expectations like one_of or
+// between more than one implement can qualify, so they're checked in name
+// order to always pick the same one.
 func SelectImplementActionForCorrection(obsv operation.Observation, obsv_result operation.ObservationResult, impls map[string]operation.Implement) (string, *operation.Action) {
-	for impl_name, impl := range impls {
+	impl_names := make([]string, 0, len(impls))
+	for impl_name := range impls {
+		impl_names = append(impl_names, impl_name)
+	}
+	sort.Strings(impl_names)
+	for _, impl_name := range impl_names {
+		impl := impls[impl_name]
 		if impl.Reacts.Corrects.Entity == obsv.Entity &&
 			impl.Reacts.Corrects.Query == obsv.Query &&
-			impl.Reacts.Corrects.Results_In == obsv.Expect {
+			obsv.Expect.IsSet() &&
+			obsv.Expect.Matches(impl.Reacts.Corrects.Results_In) {
 			for _, state := range impl.Reacts.Corrects.Starts_From {
 				if state == obsv_result.Result {
 					return impl_name, &operation.Action{
-						Path:   impl.Path,
-						Script: impl.Script,
-						Exe:    impl.Exe,
-						Args:   impl.Reacts.Args,
+						Path:          impl.Path,
+						Script:        impl.Script,
+						Exe:           impl.Exe,
+						Args:          impl.Reacts.Args,
+						Supports_Noop: impl.Reacts.Supports_Noop,
+						Timeout:       impl.Timeout,
+						Output:        reactOutputMode(impl),
+						Retry:         impl.Retry,
+						Environment:   impl.Environment,
+						Become:        impl.Become,
 					}
 				}
 			}
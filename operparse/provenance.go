@@ -0,0 +1,102 @@
+package operparse
+
+import (
+	"bytes"
+
+	"github.com/puppetlabs/regulator/operation"
+	"gopkg.in/yaml.v3"
+)
+
+// Top level spec sections that contain named definitions
+var definitionSections = []string{"observations", "reactions", "actions", "implements", "vars"}
+
+// yaml.v2 doesn't keep line numbers around after unmarshalling, so the raw
+// yaml is parsed again in to yaml.v3 nodes (which do) to find the line each
+// named definition starts on. Only the first document is looked at since
+// it's the only one yaml.v2 unmarshals. Anything that can't be found, or
+// yaml that doesn't parse this way, just won't have a line number.
+func locateDefinitions(raw_data []byte) map[string]map[string]int {
+	lines := make(map[string]map[string]int)
+	for _, section := range definitionSections {
+		lines[section] = make(map[string]int)
+	}
+	var document yaml.Node
+	err := yaml.NewDecoder(bytes.NewReader(raw_data)).Decode(&document)
+	if err != nil || len(document.Content) == 0 {
+		return lines
+	}
+	walkMapping(document.Content[0], func(section_key *yaml.Node, section_value *yaml.Node) {
+		section_lines, tracked := lines[section_key.Value]
+		if !tracked {
+			return
+		}
+		walkMapping(section_value, func(name_key *yaml.Node, _ *yaml.Node) {
+			if _, seen := section_lines[name_key.Value]; !seen {
+				section_lines[name_key.Value] = name_key.Line
+			}
+		})
+	})
+	return lines
+}
+
+// Calls visit with every key and value of a mapping node, following
+// aliases and merge keys ("<<: *anchor") the same way unmarshalling does.
+// Keys set in the mapping itself are visited before merged ones, so the
+// first time a key is visited is the definition that's actually used.
+func walkMapping(node *yaml.Node, visit func(key *yaml.Node, value *yaml.Node)) {
+	node = resolveAlias(node)
+	if node == nil || node.Kind != yaml.MappingNode {
+		return
+	}
+	var merged []*yaml.Node
+	for index := 0; index+1 < len(node.Content); index += 2 {
+		key := node.Content[index]
+		value := node.Content[index+1]
+		if key.Tag == "!!merge" {
+			merged = append(merged, mergeSources(value)...)
+			continue
+		}
+		visit(key, value)
+	}
+	for _, source := range merged {
+		walkMapping(source, visit)
+	}
+}
+
+// A merge key's value is either one map or a list of them
+func mergeSources(value *yaml.Node) []*yaml.Node {
+	value = resolveAlias(value)
+	if value != nil && value.Kind == yaml.SequenceNode {
+		return value.Content
+	}
+	return []*yaml.Node{value}
+}
+
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for node != nil && node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	return node
+}
+
+// Builds the provenance for a freshly unmarshalled spec
+func buildProvenance(data *operation.Operations, raw_data []byte, file string) *operation.Provenance {
+	lines := locateDefinitions(raw_data)
+	prov := operation.NewProvenance()
+	for obsv_name := range data.Observations {
+		prov.Observations[obsv_name] = operation.Location{File: file, Line: lines["observations"][obsv_name]}
+	}
+	for rctn_name := range data.Reactions {
+		prov.Reactions[rctn_name] = operation.Location{File: file, Line: lines["reactions"][rctn_name]}
+	}
+	for actn_name := range data.Actions {
+		prov.Actions[actn_name] = operation.Location{File: file, Line: lines["actions"][actn_name]}
+	}
+	for impl_name := range data.Implements {
+		prov.Implements[impl_name] = operation.Location{File: file, Line: lines["implements"][impl_name]}
+	}
+	for var_name := range data.Vars {
+		prov.Vars[var_name] = operation.Location{File: file, Line: lines["vars"][var_name]}
+	}
+	return prov
+}
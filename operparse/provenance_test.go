@@ -0,0 +1,114 @@
+package operparse
+
+import (
+	"testing"
+)
+
+func TestBuildProvenance(t *testing.T) {
+	tests := []struct {
+		name  string
+		yaml  string
+		lines map[string]int
+	}{
+		{
+			"block maps",
+			`# a comment
+observations:
+  web up:
+    entity: w
+    query: u
+    instance: x
+
+  db up:
+    entity: d
+    query: u
+    instance: x
+`,
+			map[string]int{"web up": 3, "db up": 8},
+		},
+		{
+			"flow maps",
+			`observations: {web up: {entity: w, query: u, instance: x},
+  db up: {entity: d, query: u, instance: x}}
+`,
+			map[string]int{"web up": 1, "db up": 2},
+		},
+		{
+			"quoted keys",
+			`observations:
+  "web: up": {entity: w, query: u, instance: x}
+  'db ''up''':
+    entity: d
+    query: u
+    instance: x
+`,
+			map[string]int{"web: up": 2, "db 'up'": 3},
+		},
+		{
+			"anchors and merge keys",
+			`vars:
+  base: &base
+    entity: w
+    query: u
+  more: &more
+    merged up: {entity: m, query: u, instance: x}
+observations:
+  <<: *more
+  web up:
+    <<: *base
+    instance: x
+  copied up: *base
+`,
+			map[string]int{"web up": 9, "copied up": 12, "merged up": 6},
+		},
+		{
+			"multiple documents",
+			`---
+observations:
+  web up: {entity: w, query: u, instance: x}
+---
+observations:
+  web up: {entity: other, query: u, instance: x}
+  db up: {entity: d, query: u, instance: x}
+`,
+			map[string]int{"web up": 3},
+		},
+		{
+			"keys that look like sections",
+			`vars:
+  observations: 1
+observations:
+  reactions: {entity: w, query: u, instance: x}
+`,
+			map[string]int{"reactions": 4},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ops, rgerr := unmarshalOperations([]byte(test.yaml), "spec.yaml")
+			if rgerr != nil {
+				t.Fatalf("unmarshal failed: %s", rgerr.Message)
+			}
+			if len(ops.Observations) != len(test.lines) {
+				t.Fatalf("unmarshalled %d observations, want %d", len(ops.Observations), len(test.lines))
+			}
+			for obsv_name, want := range test.lines {
+				loc, found := ops.Provenance.Observations[obsv_name]
+				if !found {
+					t.Errorf("no provenance for '%s'", obsv_name)
+					continue
+				}
+				if loc.File != "spec.yaml" || loc.Line != want {
+					t.Errorf("'%s' got %s:%d, want spec.yaml:%d", obsv_name, loc.File, loc.Line, want)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildProvenanceUnparseable(t *testing.T) {
+	lines := locateDefinitions([]byte("observations: [unclosed"))
+	if len(lines["observations"]) != 0 {
+		t.Errorf("got %v, want no lines", lines["observations"])
+	}
+}
@@ -0,0 +1,128 @@
+package operparse
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/puppetlabs/regulator/operation"
+	"github.com/puppetlabs/regulator/rgerror"
+)
+
+// Checks the depends_on fields of every reaction in data, the same way
+// BuildReactionOrder does, with each finding pointing at where its
+// reaction was defined
+func CheckReactionGraph(data *operation.Operations) *rgerror.RGerror {
+	_, rgerr := BuildReactionOrder(data.Reactions)
+	if rgerr == nil || data.Provenance == nil {
+		return rgerr
+	}
+	// BuildReactionOrder doesn't know where reactions came from
+	for index, finding := range rgerr.Findings {
+		if finding.File == "" {
+			loc := data.Provenance.Reactions[finding.Operation]
+			rgerr.Findings[index].File = loc.File
+			rgerr.Findings[index].Line = loc.Line
+		}
+	}
+	return rgerr
+}
+
+// Builds the order reactions should run in based on their depends_on
+// fields. Reactions are treated as a DAG and sorted topologically, any
+// reaction that depends on a reaction that doesn't exist or any cycle
+// in the graph is a finding in the returned ValidationError.
+//
+// Reactions that don't depend on each other are sorted by name so the
+// order is the same from one run to the next (ranging over the reactions
+// map directly would give a random order every time)
+func BuildReactionOrder(rctns map[string]operation.Reaction) ([]string, *rgerror.RGerror) {
+	// How many unresolved dependencies each reaction has and, for each
+	// reaction, the reactions that are waiting on it
+	waiting_on := make(map[string]int)
+	dependents := make(map[string][]string)
+	var findings []rgerror.Finding
+	for rctn_name, rctn := range rctns {
+		waiting_on[rctn_name] = 0
+		seen := make(map[string]bool)
+		for _, dep_name := range rctn.Depends_On {
+			if _, found := rctns[dep_name]; !found {
+				findings = append(findings, rgerror.Finding{
+					Kind:           "unknown_reference",
+					Operation_Type: "reaction",
+					Operation:      rctn_name,
+					Message:        fmt.Sprintf("Reaction '%s' depends on '%s', which is not a known reaction", rctn_name, dep_name),
+				})
+				continue
+			}
+			if dep_name == rctn_name {
+				findings = append(findings, rgerror.Finding{
+					Kind:           "cycle",
+					Operation_Type: "reaction",
+					Operation:      rctn_name,
+					Message:        fmt.Sprintf("Reaction '%s' cannot depend on itself", rctn_name),
+				})
+				continue
+			}
+			// Listing the same dependency twice shouldn't count twice
+			if seen[dep_name] {
+				continue
+			}
+			seen[dep_name] = true
+			waiting_on[rctn_name]++
+			dependents[dep_name] = append(dependents[dep_name], rctn_name)
+		}
+	}
+
+	// Unknown dependencies were left out of the graph above, so cycles
+	// can still be found and reported alongside them
+	var ready []string
+	for rctn_name, count := range waiting_on {
+		if count == 0 {
+			ready = append(ready, rctn_name)
+		}
+	}
+	sort.Strings(ready)
+
+	order := make([]string, 0, len(rctns))
+	for len(ready) > 0 {
+		current := ready[0]
+		ready = ready[1:]
+		order = append(order, current)
+		newly_ready := []string{}
+		for _, dependent := range dependents[current] {
+			waiting_on[dependent]--
+			if waiting_on[dependent] == 0 {
+				newly_ready = append(newly_ready, dependent)
+			}
+		}
+		if len(newly_ready) > 0 {
+			ready = append(ready, newly_ready...)
+			sort.Strings(ready)
+		}
+	}
+
+	// Anything left with unresolved dependencies is part of (or
+	// downstream of) a cycle
+	if len(order) != len(rctns) {
+		var stuck []string
+		for rctn_name, count := range waiting_on {
+			if count > 0 {
+				stuck = append(stuck, rctn_name)
+			}
+		}
+		sort.Strings(stuck)
+		for _, rctn_name := range stuck {
+			findings = append(findings, rgerror.Finding{
+				Kind:           "cycle",
+				Operation_Type: "reaction",
+				Operation:      rctn_name,
+				Message:        fmt.Sprintf("Reaction '%s' is part of or depends on a dependency cycle, could not order: '%s'", rctn_name, strings.Join(stuck, "', '")),
+			})
+		}
+	}
+	if len(findings) > 0 {
+		return nil, rgerror.NewValidationError(findings)
+	}
+	return order, nil
+}
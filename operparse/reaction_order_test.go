@@ -0,0 +1,148 @@
+package operparse
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/puppetlabs/regulator/operation"
+)
+
+func reactionsDependingOn(deps map[string][]string) map[string]operation.Reaction {
+	rctns := make(map[string]operation.Reaction)
+	for rctn_name, dep_names := range deps {
+		rctns[rctn_name] = operation.Reaction{Action: "a", Depends_On: dep_names}
+	}
+	return rctns
+}
+
+func TestBuildReactionOrder(t *testing.T) {
+	tests := []struct {
+		name string
+		deps map[string][]string
+		want []string
+	}{
+		{
+			"no reactions",
+			map[string][]string{},
+			[]string{},
+		},
+		{
+			"independent reactions sorted by name",
+			map[string][]string{"c": nil, "a": nil, "b": nil},
+			[]string{"a", "b", "c"},
+		},
+		{
+			"dependencies first",
+			map[string][]string{"a": {"c"}, "b": nil, "c": {"b"}},
+			[]string{"b", "c", "a"},
+		},
+		{
+			"ready reactions sorted together",
+			map[string][]string{"z": nil, "y": {"z"}, "a": {"z"}, "m": nil},
+			[]string{"m", "z", "a", "y"},
+		},
+		{
+			"diamond",
+			map[string][]string{"top": nil, "left": {"top"}, "right": {"top"}, "bottom": {"right", "left"}},
+			[]string{"top", "left", "right", "bottom"},
+		},
+		{
+			"duplicate dependency",
+			map[string][]string{"a": {"b", "b"}, "b": nil},
+			[]string{"b", "a"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rctns := reactionsDependingOn(test.deps)
+			// Map order is random, so make sure it doesn't leak in to
+			// the result
+			for attempt := 0; attempt < 20; attempt++ {
+				order, rgerr := BuildReactionOrder(rctns)
+				if rgerr != nil {
+					t.Fatalf("unexpected error: %s", rgerr.Message)
+				}
+				if !reflect.DeepEqual(order, test.want) {
+					t.Fatalf("got %v, want %v", order, test.want)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildReactionOrderFindings(t *testing.T) {
+	tests := []struct {
+		name  string
+		deps  map[string][]string
+		kinds map[string]string
+	}{
+		{
+			"depends on itself",
+			map[string][]string{"a": {"a"}},
+			map[string]string{"a": "cycle"},
+		},
+		{
+			"two reaction cycle",
+			map[string][]string{"a": {"b"}, "b": {"a"}, "c": nil},
+			map[string]string{"a": "cycle", "b": "cycle"},
+		},
+		{
+			"downstream of a cycle",
+			map[string][]string{"a": {"b"}, "b": {"c"}, "c": {"b"}},
+			map[string]string{"a": "cycle", "b": "cycle", "c": "cycle"},
+		},
+		{
+			"unknown dependency",
+			map[string][]string{"a": {"missing"}},
+			map[string]string{"a": "unknown_reference"},
+		},
+		{
+			"unknown dependency and cycle",
+			map[string][]string{"a": {"missing"}, "b": {"c"}, "c": {"b"}},
+			map[string]string{"a": "unknown_reference", "b": "cycle", "c": "cycle"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			order, rgerr := BuildReactionOrder(reactionsDependingOn(test.deps))
+			if rgerr == nil {
+				t.Fatalf("expected an error, got order %v", order)
+			}
+			kinds := make(map[string]string)
+			for _, finding := range rgerr.Findings {
+				kinds[finding.Operation] = finding.Kind
+			}
+			if !reflect.DeepEqual(kinds, test.kinds) {
+				t.Errorf("got findings %v, want %v", kinds, test.kinds)
+			}
+		})
+	}
+}
+
+func TestCheckReactionGraphProvenance(t *testing.T) {
+	data := &operation.Operations{
+		Reactions: reactionsDependingOn(map[string][]string{"a": {"b"}, "b": {"a"}}),
+		Provenance: &operation.Provenance{
+			Reactions: map[string]operation.Location{
+				"a": {File: "spec.yaml", Line: 3},
+				"b": {File: "spec.yaml", Line: 7},
+			},
+		},
+	}
+	rgerr := CheckReactionGraph(data)
+	if rgerr == nil {
+		t.Fatalf("expected an error")
+	}
+	var lines []int
+	for _, finding := range rgerr.Findings {
+		if finding.File != "spec.yaml" {
+			t.Errorf("finding for '%s' has file '%s'", finding.Operation, finding.File)
+		}
+		lines = append(lines, finding.Line)
+	}
+	sort.Ints(lines)
+	if !reflect.DeepEqual(lines, []int{3, 7}) {
+		t.Errorf("got lines %v, want [3 7]", lines)
+	}
+}
@@ -0,0 +1,163 @@
+package operparse
+
+import (
+	"fmt"
+	"path"
+	"sort"
+
+	"github.com/puppetlabs/regulator/expression"
+	"github.com/puppetlabs/regulator/operation"
+	"github.com/puppetlabs/regulator/rgerror"
+)
+
+// Checks every --only and --skip glob is valid, path.Match only says so
+// when it's asked to match something
+func CheckSelector(selector operation.Selector) *rgerror.RGerror {
+	patterns := append(append([]string{}, selector.Only...), selector.Skip...)
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return &rgerror.RGerror{
+				Kind:    rgerror.InvalidInput,
+				Message: fmt.Sprintf("Invalid --only or --skip pattern '%s': %s", pattern, err),
+				Origin:  err,
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the part of a spec the selector picks out. Selected reactions
+// bring along the reactions they depend on and the observations they
+// need (their own observation plus any their 'when' expression refers
+// to), whether those are selected or not, since they can't run without
+// them. Skipping something a selected reaction needs is an error.
+//
+// Actions and implements are always kept, reactions need them and run
+// looks its action up by name.
+func SelectOperations(data *operation.Operations, selector operation.Selector) (*operation.Operations, *rgerror.RGerror) {
+	if !selector.IsSet() {
+		return data, nil
+	}
+	rgerr := CheckSelector(selector)
+	if rgerr != nil {
+		return nil, rgerr
+	}
+	selected := &operation.Operations{
+		Reactions:    make(map[string]operation.Reaction),
+		Observations: make(map[string]operation.Observation),
+		Implements:   data.Implements,
+		Actions:      data.Actions,
+		Vars:         data.Vars,
+		Include:      data.Include,
+		Provenance:   data.Provenance,
+	}
+	for obsv_name, obsv := range data.Observations {
+		if selector.Selects(obsv_name, obsv.Tags) {
+			selected.Observations[obsv_name] = obsv
+		}
+	}
+
+	// Sorted so the first problem found is always the same one
+	var pending []string
+	for rctn_name, rctn := range data.Reactions {
+		if selector.Selects(rctn_name, rctn.Tags) {
+			pending = append(pending, rctn_name)
+		}
+	}
+	sort.Strings(pending)
+	for len(pending) > 0 {
+		rctn_name := pending[0]
+		pending = pending[1:]
+		if _, already_selected := selected.Reactions[rctn_name]; already_selected {
+			continue
+		}
+		rctn := data.Reactions[rctn_name]
+		selected.Reactions[rctn_name] = rctn
+		for _, dep_name := range rctn.Depends_On {
+			if _, found := data.Reactions[dep_name]; !found {
+				// Unknown dependencies are reported when the spec is loaded
+				continue
+			}
+			if selector.Skips(dep_name) {
+				return nil, neededButSkipped("reaction", rctn_name, "depends on", dep_name)
+			}
+			pending = append(pending, dep_name)
+		}
+		obsv_names, all := observationsNeeded(rctn)
+		if all {
+			for obsv_name, obsv := range data.Observations {
+				if !selector.Skips(obsv_name) {
+					selected.Observations[obsv_name] = obsv
+				}
+			}
+		}
+		for _, obsv_name := range obsv_names {
+			obsv, found := data.Observations[obsv_name]
+			if !found {
+				continue
+			}
+			if selector.Skips(obsv_name) {
+				return nil, neededButSkipped("observation", rctn_name, "needs", obsv_name)
+			}
+			selected.Observations[obsv_name] = obsv
+		}
+	}
+	return selected, nil
+}
+
+// observe doesn't run reactions, so it only gets the observations the
+// selector picks out, not the ones selected reactions would bring along
+func SelectObservations(data *operation.Operations, selector operation.Selector) (*operation.Operations, *rgerror.RGerror) {
+	if !selector.IsSet() {
+		return data, nil
+	}
+	without_reactions := *data
+	without_reactions.Reactions = make(map[string]operation.Reaction)
+	return SelectOperations(&without_reactions, selector)
+}
+
+// The observations a reaction needs results for. all is true if its
+// 'when' expression could refer to any of them.
+func observationsNeeded(rctn operation.Reaction) (obsv_names []string, all bool) {
+	if rctn.Observation != "" {
+		obsv_names = append(obsv_names, rctn.Observation)
+	}
+	if rctn.When == "" {
+		return obsv_names, false
+	}
+	expr, rgerr := expression.Parse(rctn.When)
+	if rgerr != nil {
+		// Reported when the reaction runs
+		return obsv_names, false
+	}
+	for _, object_name := range []string{WHEN_RESULTS_NAME, WHEN_OBSERVATIONS_NAME} {
+		keys, all_keys := expr.Keys(object_name)
+		obsv_names = append(obsv_names, keys...)
+		all = all || all_keys
+	}
+	return obsv_names, all
+}
+
+func neededButSkipped(skipped_type string, rctn_name string, need string, skipped_name string) *rgerror.RGerror {
+	return &rgerror.RGerror{
+		Kind:      rgerror.InvalidInput,
+		Message:   fmt.Sprintf("Reaction '%s' %s %s '%s', which --skip excludes", rctn_name, need, skipped_type, skipped_name),
+		Origin:    nil,
+		Operation: fmt.Sprintf("reaction '%s'", rctn_name),
+		Hint:      fmt.Sprintf("Skip '%s' as well, or don't skip '%s'", rctn_name, skipped_name),
+	}
+}
+
+// run is given its action by name, so the selector can only say no to it
+func CheckActionSelected(actn_name string, data *operation.Operations, selector operation.Selector) *rgerror.RGerror {
+	actn, found := data.Actions[actn_name]
+	if !found || selector.Selects(actn_name, actn.Tags) {
+		return nil
+	}
+	return &rgerror.RGerror{
+		Kind:      rgerror.InvalidInput,
+		Message:   fmt.Sprintf("Action '%s' is excluded by --only, --skip, or --tags", actn_name),
+		Origin:    nil,
+		Operation: fmt.Sprintf("action '%s'", actn_name),
+	}
+}
@@ -0,0 +1,161 @@
+package operparse
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/puppetlabs/regulator/operation"
+)
+
+func selectionSpec() *operation.Operations {
+	return &operation.Operations{
+		Observations: map[string]operation.Observation{
+			"gcloud count": {Entity: "g", Query: "count", Tags: []string{"gcloud"}},
+			"gcloud up":    {Entity: "g", Query: "up", Tags: []string{"gcloud"}},
+			"db up":        {Entity: "d", Query: "up"},
+			"web up":       {Entity: "w", Query: "up", Tags: []string{"web"}},
+			"disk":         {Entity: "k", Query: "free"},
+		},
+		Reactions: map[string]operation.Reaction{
+			"fix gcloud": {Action: "a", Observation: "gcloud up", Depends_On: []string{"prep"}, Tags: []string{"gcloud"}},
+			"prep":       {Action: "a", When: `results["db up"] == "1"`},
+			"fix web":    {Action: "a", Observation: "web up", Tags: []string{"web"}},
+			"anything":   {Action: "a", When: `results[name] == "1"`},
+		},
+		Actions: map[string]operation.Action{
+			"a":    {Exe: "sh"},
+			"tidy": {Exe: "sh", Tags: []string{"cleanup"}},
+		},
+	}
+}
+
+func operationNames(selected *operation.Operations) ([]string, []string) {
+	var obsv_names, rctn_names []string
+	for obsv_name := range selected.Observations {
+		obsv_names = append(obsv_names, obsv_name)
+	}
+	for rctn_name := range selected.Reactions {
+		rctn_names = append(rctn_names, rctn_name)
+	}
+	sort.Strings(obsv_names)
+	sort.Strings(rctn_names)
+	return obsv_names, rctn_names
+}
+
+func TestSelectOperations(t *testing.T) {
+	tests := []struct {
+		name         string
+		selector     operation.Selector
+		observations []string
+		reactions    []string
+	}{
+		{
+			"tag brings along dependencies and their observations",
+			operation.Selector{Tags: []string{"gcloud"}},
+			[]string{"db up", "gcloud count", "gcloud up"},
+			[]string{"fix gcloud", "prep"},
+		},
+		{
+			"glob",
+			operation.Selector{Only: []string{"gcloud *"}},
+			[]string{"gcloud count", "gcloud up"},
+			nil,
+		},
+		{
+			"glob and tag must both match",
+			operation.Selector{Only: []string{"fix *"}, Tags: []string{"web"}},
+			[]string{"web up"},
+			[]string{"fix web"},
+		},
+		{
+			"skip glob",
+			operation.Selector{Only: []string{"fix web", "d*"}, Skip: []string{"gcloud*"}},
+			[]string{"db up", "disk", "web up"},
+			[]string{"fix web"},
+		},
+		{
+			"when that can refer to anything needs every observation",
+			operation.Selector{Only: []string{"anything"}, Skip: []string{"disk"}},
+			[]string{"db up", "gcloud count", "gcloud up", "web up"},
+			[]string{"anything"},
+		},
+		{
+			"unknown tag selects nothing",
+			operation.Selector{Tags: []string{"nope"}},
+			nil,
+			nil,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			selected, rgerr := SelectOperations(selectionSpec(), test.selector)
+			if rgerr != nil {
+				t.Fatalf("unexpected error: %s", rgerr.Message)
+			}
+			obsv_names, rctn_names := operationNames(selected)
+			if !reflect.DeepEqual(obsv_names, test.observations) {
+				t.Errorf("got observations %v, want %v", obsv_names, test.observations)
+			}
+			if !reflect.DeepEqual(rctn_names, test.reactions) {
+				t.Errorf("got reactions %v, want %v", rctn_names, test.reactions)
+			}
+			if len(selected.Actions) != 2 {
+				t.Errorf("actions should always be kept, got %d", len(selected.Actions))
+			}
+		})
+	}
+}
+
+func TestSelectOperationsErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		selector operation.Selector
+	}{
+		{"skipped dependency", operation.Selector{Tags: []string{"gcloud"}, Skip: []string{"prep"}}},
+		{"skipped observation", operation.Selector{Only: []string{"fix web"}, Skip: []string{"web *"}}},
+		{"skipped when observation", operation.Selector{Only: []string{"prep"}, Skip: []string{"db up"}}},
+		{"bad glob", operation.Selector{Only: []string{"[gcloud"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			selected, rgerr := SelectOperations(selectionSpec(), test.selector)
+			if rgerr == nil {
+				obsv_names, rctn_names := operationNames(selected)
+				t.Fatalf("expected an error, selected %v and %v", obsv_names, rctn_names)
+			}
+		})
+	}
+}
+
+func TestSelectObservations(t *testing.T) {
+	selected, rgerr := SelectObservations(selectionSpec(), operation.Selector{Tags: []string{"gcloud"}})
+	if rgerr != nil {
+		t.Fatalf("unexpected error: %s", rgerr.Message)
+	}
+	obsv_names, rctn_names := operationNames(selected)
+	if !reflect.DeepEqual(obsv_names, []string{"gcloud count", "gcloud up"}) || rctn_names != nil {
+		t.Errorf("got observations %v and reactions %v", obsv_names, rctn_names)
+	}
+}
+
+func TestSelectOperationsNoSelector(t *testing.T) {
+	data := selectionSpec()
+	selected, rgerr := SelectOperations(data, operation.Selector{})
+	if rgerr != nil || selected != data {
+		t.Errorf("an empty selector should return the spec as it is")
+	}
+}
+
+func TestCheckActionSelected(t *testing.T) {
+	data := selectionSpec()
+	if rgerr := CheckActionSelected("tidy", data, operation.Selector{Tags: []string{"cleanup"}}); rgerr != nil {
+		t.Errorf("unexpected error: %s", rgerr.Message)
+	}
+	if rgerr := CheckActionSelected("tidy", data, operation.Selector{Skip: []string{"t*"}}); rgerr == nil {
+		t.Errorf("expected skipped action to be an error")
+	}
+	if rgerr := CheckActionSelected("missing", data, operation.Selector{Only: []string{"a"}}); rgerr != nil {
+		t.Errorf("unknown actions are reported elsewhere, got: %s", rgerr.Message)
+	}
+}
@@ -0,0 +1,225 @@
+package operparse
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/puppetlabs/regulator/localfile"
+	"github.com/puppetlabs/regulator/operation"
+	"github.com/puppetlabs/regulator/rgerror"
+	"gopkg.in/yaml.v2"
+)
+
+// Keeps track of which files have been merged so far while following
+// include directives
+type specLoader struct {
+	data *operation.Operations
+	// Absolute paths of every file already merged in to data, so that
+	// a file included from two places is only loaded once
+	loaded map[string]bool
+	// Files currently being loaded, outermost first, used to find
+	// include cycles
+	stack []string
+	// Every problem found so far. Loading carries on past problems so
+	// they can all be reported at once
+	findings []rgerror.Finding
+	// Set when a whole file couldn't be loaded, in which case checks that
+	// need the full spec (like the reaction graph) would only add noise
+	incomplete bool
+}
+
+func newSpecLoader(data *operation.Operations) *specLoader {
+	return &specLoader{
+		data:   data,
+		loaded: make(map[string]bool),
+	}
+}
+
+// Loads and merges every spec source in order, following any include
+// directives. Sources are file paths or localfile.STDIN_IDENTIFIER.
+//
+// The reaction graph is only checked once everything is loaded, since
+// reactions can depend on reactions from other files.
+func LoadSpecs(sources []string) (*operation.Operations, *rgerror.RGerror) {
+	data := &operation.Operations{}
+	loader := newSpecLoader(data)
+	for _, source := range sources {
+		var rgerr *rgerror.RGerror
+		if source == localfile.STDIN_IDENTIFIER {
+			rgerr = loader.loadStdin()
+		} else {
+			rgerr = loader.loadFile(source)
+		}
+		if rgerr != nil {
+			return nil, rgerr
+		}
+	}
+	rgerr := loader.finish()
+	if rgerr != nil {
+		return nil, rgerr
+	}
+	return data, nil
+}
+
+func (loader *specLoader) addFindings(rgerr *rgerror.RGerror, label string) {
+	if len(rgerr.Findings) > 0 {
+		loader.findings = append(loader.findings, rgerr.Findings...)
+	} else {
+		loader.findings = append(loader.findings, rgerror.Finding{
+			Kind:    "invalid",
+			File:    label,
+			Message: rgerr.Message,
+		})
+	}
+}
+
+// Runs the checks that need everything loaded and returns every finding
+// as one ValidationError
+func (loader *specLoader) finish() *rgerror.RGerror {
+	if !loader.incomplete {
+		rgerr := CheckReactionGraph(loader.data)
+		if rgerr != nil {
+			loader.findings = append(loader.findings, rgerr.Findings...)
+		}
+	}
+	return loader.report()
+}
+
+// Every finding so far as one ValidationError, or nil if there aren't any
+func (loader *specLoader) report() *rgerror.RGerror {
+	if len(loader.findings) > 0 {
+		return rgerror.NewValidationError(loader.findings)
+	}
+	return nil
+}
+
+func unmarshalOperations(raw_data []byte, label string) (*operation.Operations, *rgerror.RGerror) {
+	unmarshald_data := operation.Operations{}
+	err := yaml.UnmarshalStrict(raw_data, &unmarshald_data)
+	if err != nil {
+		return nil, &rgerror.RGerror{
+			Kind:    rgerror.ExecError,
+			Message: fmt.Sprintf("Failed to parse yaml: %s", err),
+			Origin:  err,
+		}
+	}
+	unmarshald_data.Provenance = buildProvenance(&unmarshald_data, raw_data, label)
+	return &unmarshald_data, nil
+}
+
+// Includes in specs read from stdin are relative to the working directory
+func (loader *specLoader) loadStdin() *rgerror.RGerror {
+	raw_data, rgerr := localfile.ReadFileOrStdin(localfile.STDIN_IDENTIFIER)
+	if rgerr != nil {
+		return rgerr
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return &rgerror.RGerror{
+			Kind:    rgerror.ExecError,
+			Message: "Failed to find the working directory to resolve includes",
+			Origin:  err,
+		}
+	}
+	return loader.loadRaw(raw_data, "stdin", cwd)
+}
+
+func (loader *specLoader) loadFile(location string) *rgerror.RGerror {
+	abs_location, err := filepath.Abs(location)
+	if err != nil {
+		return &rgerror.RGerror{
+			Kind:    rgerror.ExecError,
+			Message: fmt.Sprintf("Failed to resolve path %s", location),
+			Origin:  err,
+		}
+	}
+	for index, loading := range loader.stack {
+		if loading == abs_location {
+			cycle := append(append([]string{}, loader.stack[index:]...), abs_location)
+			loader.incomplete = true
+			loader.findings = append(loader.findings, rgerror.Finding{
+				Kind:    "include_cycle",
+				File:    loader.stack[len(loader.stack)-1],
+				Message: fmt.Sprintf("Include cycle found: %s", strings.Join(cycle, " -> ")),
+			})
+			return nil
+		}
+	}
+	if loader.loaded[abs_location] {
+		return nil
+	}
+	// ReadFileInChunks creates files that don't exist, so check first
+	if info, err := os.Stat(abs_location); err != nil || info.IsDir() {
+		loader.incomplete = true
+		loader.findings = append(loader.findings, rgerror.Finding{
+			Kind:    "missing_file",
+			File:    abs_location,
+			Message: fmt.Sprintf("Spec file %s does not exist or is not a file", abs_location),
+		})
+		return nil
+	}
+	raw_data, rgerr := localfile.ReadFileInChunks(abs_location)
+	if rgerr != nil {
+		return rgerr
+	}
+	loader.stack = append(loader.stack, abs_location)
+	rgerr = loader.loadRaw(raw_data, abs_location, filepath.Dir(abs_location))
+	loader.stack = loader.stack[:len(loader.stack)-1]
+	if rgerr != nil {
+		return rgerr
+	}
+	loader.loaded[abs_location] = true
+	return nil
+}
+
+// Included files are merged before the file that includes them. Problems
+// with the spec are recorded as findings, only errors that stop loading
+// altogether are returned.
+func (loader *specLoader) loadRaw(raw_data []byte, label string, base_dir string) *rgerror.RGerror {
+	parsed, rgerr := unmarshalOperations(raw_data, label)
+	if rgerr != nil {
+		loader.incomplete = true
+		loader.findings = append(loader.findings, rgerror.Finding{
+			Kind:    "parse",
+			File:    label,
+			Message: rgerr.Message,
+		})
+		return nil
+	}
+	for _, include := range parsed.Include {
+		pattern := include
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(base_dir, pattern)
+		}
+		// Glob results are sorted, so included globs load in a
+		// deterministic order
+		matches, err := filepath.Glob(pattern)
+		if err != nil || len(matches) == 0 {
+			message := fmt.Sprintf("Include '%s' does not match any files", include)
+			if err != nil {
+				message = fmt.Sprintf("Include '%s' is not a valid path or glob: %s", include, err)
+			}
+			loader.incomplete = true
+			loader.findings = append(loader.findings, rgerror.Finding{
+				Kind:    "include",
+				File:    label,
+				Message: message,
+			})
+			continue
+		}
+		for _, match := range matches {
+			rgerr = loader.loadFile(match)
+			if rgerr != nil {
+				return rgerr
+			}
+		}
+	}
+	parsed.Include = nil
+	rgerr = ConcatOperations(loader.data, parsed)
+	if rgerr != nil {
+		loader.addFindings(rgerr, label)
+	}
+	return nil
+}
@@ -7,7 +7,9 @@ import (
 	"github.com/puppetlabs/regulator/cli"
 	"github.com/puppetlabs/regulator/local"
 	"github.com/puppetlabs/regulator/localfile"
+	"github.com/puppetlabs/regulator/operation"
 	"github.com/puppetlabs/regulator/remote"
+	"github.com/puppetlabs/regulator/render"
 )
 
 func main() {
@@ -22,18 +24,91 @@ func main() {
 	// the flag package can ignore any required commands
 	// before parsing
 	local_flag_set := flag.NewFlagSet("local_options", flag.ExitOnError)
-	local_input_file := local_flag_set.String("file", "", "Path to spec yaml file (must use one of --file or --stdin)")
-	local_use_stdin := local_flag_set.Bool("stdin", false, "Read spec from stdin (must use one of --file or --stdin)")
+	var local_input_files cli.StringList
+	local_flag_set.Var(&local_input_files, "file", "Path to spec yaml file, can be passed more than once (must use --file, --dir, or --stdin)")
+	local_input_dir := local_flag_set.String("dir", "", "Load every *.yaml spec file in a directory (must use --file, --dir, or --stdin)")
+	local_use_stdin := local_flag_set.Bool("stdin", false, "Read spec from stdin (must use --file, --dir, or --stdin)")
+	local_flag_set.String("error-format", "text", "How to print errors, either text or json")
+	local_timeout := local_flag_set.String("timeout", "", "Kill any observation or action that runs longer than this, e.g. 30s or 5m, unless it sets its own timeout")
+	local_parallelism := local_flag_set.Int("parallelism", 1, "How many observations can run at once")
+	local_fail_on := local_flag_set.String("fail-on", "failed", "Which results make regulator exit non-zero: none, failed (failed observations or reactions), or unexpected (failed, or unexpected observations)")
+	var local_only, local_skip, local_tags cli.StringList
+	local_flag_set.Var(&local_only, "only", "Only work with operations with this name or matching this glob, can be passed more than once")
+	local_flag_set.Var(&local_skip, "skip", "Leave out operations with this name or matching this glob, can be passed more than once")
+	local_flag_set.Var(&local_tags, "tags", "Only work with operations with this tag, can be passed more than once")
+	local_format := local_flag_set.String("format", "json", "How to print results: json, yaml, table, junit, or tap (observe, plan, react, and run)")
+	local_pretty := local_flag_set.Bool("pretty", false, "Indent json results")
+	local_color := local_flag_set.String("color", "auto", "Whether to color table results: auto (only on a terminal, unless NO_COLOR is set), always, or never")
+	local_noop := local_flag_set.Bool("noop", false, "Only run reactions whose action supports noop, in noop mode, and report what they would change (react only)")
 
 	remote_flag_set := flag.NewFlagSet("remote_options", flag.ExitOnError)
-	remote_input_file := remote_flag_set.String("file", "", "Path to spec yaml file (must use one of --file or --stdin)")
-	remote_use_stdin := remote_flag_set.Bool("stdin", false, "Read spec from stdin (must use one of --file or --stdin)")
+	var remote_input_files cli.StringList
+	remote_flag_set.Var(&remote_input_files, "file", "Path to spec yaml file, can be passed more than once (must use --file, --dir, or --stdin)")
+	remote_input_dir := remote_flag_set.String("dir", "", "Load every *.yaml spec file in a directory (must use --file, --dir, or --stdin)")
+	remote_use_stdin := remote_flag_set.Bool("stdin", false, "Read spec from stdin (must use --file, --dir, or --stdin)")
+	remote_flag_set.String("error-format", "text", "How to print errors, either text or json")
+	remote_timeout := remote_flag_set.String("timeout", "", "Kill any observation or action that runs longer than this, e.g. 30s or 5m, unless it sets its own timeout")
+	remote_session_timeout := remote_flag_set.String("session-timeout", "", "Close the ssh session if the remote command runs longer than this, e.g. 10m")
+	remote_parallelism := remote_flag_set.Int("parallelism", 1, "How many observations can run at once on the target")
+	remote_fail_on := remote_flag_set.String("fail-on", "failed", "Which results make regulator exit non-zero: none, failed (failed observations or reactions), or unexpected (failed, or unexpected observations)")
+	var remote_only, remote_skip, remote_tags cli.StringList
+	remote_flag_set.Var(&remote_only, "only", "Only work with operations with this name or matching this glob, can be passed more than once")
+	remote_flag_set.Var(&remote_skip, "skip", "Leave out operations with this name or matching this glob, can be passed more than once")
+	remote_flag_set.Var(&remote_tags, "tags", "Only work with operations with this tag, can be passed more than once")
+	remote_format := remote_flag_set.String("format", "json", "How to print results: json, yaml, table, junit, or tap (observe, plan, react, and run)")
+	remote_pretty := remote_flag_set.Bool("pretty", false, "Indent json results")
+	remote_color := remote_flag_set.String("color", "auto", "Whether to color table results: auto (only on a terminal, unless NO_COLOR is set), always, or never")
+	remote_noop := remote_flag_set.Bool("noop", false, "Only run reactions whose action supports noop, in noop mode, and report what they would change (react only)")
+	remote_become := remote_flag_set.Bool("become", false, "Run the remote regulator, and so everything it runs, as root through --become-exe. It can't ask for a password")
+	remote_become_exe := remote_flag_set.String("become-exe", "sudo", "The command to escalate with when using --become, it must accept sudo's -n flag")
 	username := remote_flag_set.String("user", os.Getenv("USER"), "Username to use when connecting via SSH")
 	port := remote_flag_set.String("port", "22", "Port to use for ssh connections")
 
+	// Only read once a command has parsed the local flags
+	local_selector := func() operation.Selector {
+		return operation.Selector{
+			Only: local_only,
+			Skip: local_skip,
+			Tags: local_tags,
+		}
+	}
+
+	// Only read once a command has parsed the local flags
+	local_render := func() render.Options {
+		return render.Options{
+			Format: *local_format,
+			Pretty: *local_pretty,
+			Color:  *local_color,
+		}
+	}
+
+	// Only read once a command has parsed the remote flags
+	remote_options := func() remote.Options {
+		return remote.Options{
+			Default_Timeout: *remote_timeout,
+			Session_Timeout: *remote_session_timeout,
+			Parallelism:     *remote_parallelism,
+			Noop:            *remote_noop,
+			Become:          *remote_become,
+			Become_Exe:      *remote_become_exe,
+			Fail_On:         *remote_fail_on,
+			Selector: operation.Selector{
+				Only: remote_only,
+				Skip: remote_skip,
+				Tags: remote_tags,
+			},
+			Render: render.Options{
+				Format: *remote_format,
+				Pretty: *remote_pretty,
+				Color:  *remote_color,
+			},
+		}
+	}
+
 	setup_flag_set := flag.NewFlagSet("setup_options", flag.ExitOnError)
 	setup_username := setup_flag_set.String("user", os.Getenv("USER"), "Username to use when connecting via SSH")
 	setup_port := setup_flag_set.String("port", "22", "Port to use for ssh connections")
+	setup_session_timeout := setup_flag_set.String("session-timeout", "", "Close the ssh session if setup runs longer than this, e.g. 10m")
 
 	// All CLI commands should follow naming rules of powershell approved verbs:
 	// https://docs.microsoft.com/en-us/powershell/scripting/developer/cmdlet/approved-verbs-for-windows-powershell-commands?view=powershell-7.2
@@ -47,16 +122,12 @@ func main() {
 				usage := "regulator observe local [FLAGS]"
 				description := "Run observation code on the local system and print out the resulting observations"
 				cli.ShouldHaveArgs(2, usage, description, local_flag_set)
-				input_file, rgerr := localfile.ChooseFileOrStdin(*local_input_file, *local_use_stdin)
+				spec_sources, rgerr := localfile.ChooseSpecSources(local_input_files, *local_input_dir, *local_use_stdin)
 				if rgerr != nil {
 					cli.HandleCommandRGerror(rgerr, usage, description, local_flag_set)
 				}
-				cli.HandleCommandRGerror(
-					local.CLIObserve(input_file),
-					usage,
-					description,
-					local_flag_set,
-				)
+				exit_code, rgerr := local.CLIObserve(spec_sources, local.RunOptions{Default_Timeout: *local_timeout, Parallelism: *local_parallelism, Fail_On: *local_fail_on, Selector: local_selector(), Render: local_render()})
+				cli.HandleCommandResult(exit_code, rgerr, usage, description, local_flag_set)
 			},
 		},
 		{
@@ -66,16 +137,42 @@ func main() {
 				usage := "regulator observe remote [TARGET] [FLAGS]"
 				description := "Run observation on a target"
 				cli.ShouldHaveArgs(3, usage, description, remote_flag_set)
-				input_file, rgerr := localfile.ChooseFileOrStdin(*remote_input_file, *remote_use_stdin)
+				spec_sources, rgerr := localfile.ChooseSpecSources(remote_input_files, *remote_input_dir, *remote_use_stdin)
 				if rgerr != nil {
 					cli.HandleCommandRGerror(rgerr, usage, description, remote_flag_set)
 				}
-				cli.HandleCommandRGerror(
-					remote.CLIObserve(input_file, *username, os.Args[3], *port),
-					usage,
-					description,
-					remote_flag_set,
-				)
+				exit_code, rgerr := remote.CLIObserve(spec_sources, *username, os.Args[3], *port, remote_options())
+				cli.HandleCommandResult(exit_code, rgerr, usage, description, remote_flag_set)
+			},
+		},
+		{
+			Verb: "plan",
+			Noun: "local",
+			ExecutionFn: func() {
+				usage := "regulator plan local [FLAGS]"
+				description := "Run observations on the local system and show which reactions would run, without running them"
+				cli.ShouldHaveArgs(2, usage, description, local_flag_set)
+				spec_sources, rgerr := localfile.ChooseSpecSources(local_input_files, *local_input_dir, *local_use_stdin)
+				if rgerr != nil {
+					cli.HandleCommandRGerror(rgerr, usage, description, local_flag_set)
+				}
+				exit_code, rgerr := local.CLIPlan(spec_sources, local.RunOptions{Default_Timeout: *local_timeout, Parallelism: *local_parallelism, Fail_On: *local_fail_on, Selector: local_selector(), Render: local_render()})
+				cli.HandleCommandResult(exit_code, rgerr, usage, description, local_flag_set)
+			},
+		},
+		{
+			Verb: "plan",
+			Noun: "remote",
+			ExecutionFn: func() {
+				usage := "regulator plan remote [TARGET] [FLAGS]"
+				description := "Run observations on a target and show which reactions would run, without running them"
+				cli.ShouldHaveArgs(3, usage, description, remote_flag_set)
+				spec_sources, rgerr := localfile.ChooseSpecSources(remote_input_files, *remote_input_dir, *remote_use_stdin)
+				if rgerr != nil {
+					cli.HandleCommandRGerror(rgerr, usage, description, remote_flag_set)
+				}
+				exit_code, rgerr := remote.CLIPlan(spec_sources, *username, os.Args[3], *port, remote_options())
+				cli.HandleCommandResult(exit_code, rgerr, usage, description, remote_flag_set)
 			},
 		},
 		{
@@ -85,16 +182,12 @@ func main() {
 				usage := "regulator react local [FLAGS]"
 				description := "React to an observation on the local system"
 				cli.ShouldHaveArgs(2, usage, description, local_flag_set)
-				input_file, rgerr := localfile.ChooseFileOrStdin(*local_input_file, *local_use_stdin)
+				spec_sources, rgerr := localfile.ChooseSpecSources(local_input_files, *local_input_dir, *local_use_stdin)
 				if rgerr != nil {
 					cli.HandleCommandRGerror(rgerr, usage, description, local_flag_set)
 				}
-				cli.HandleCommandRGerror(
-					local.CLIReact(input_file),
-					usage,
-					description,
-					local_flag_set,
-				)
+				exit_code, rgerr := local.CLIReact(spec_sources, local.RunOptions{Default_Timeout: *local_timeout, Parallelism: *local_parallelism, Noop: *local_noop, Fail_On: *local_fail_on, Selector: local_selector(), Render: local_render()})
+				cli.HandleCommandResult(exit_code, rgerr, usage, description, local_flag_set)
 			},
 		},
 		{
@@ -104,16 +197,12 @@ func main() {
 				usage := "regulator react remote [TARGET] [FLAGS]"
 				description := "React to an observation on a target"
 				cli.ShouldHaveArgs(3, usage, description, remote_flag_set)
-				input_file, rgerr := localfile.ChooseFileOrStdin(*remote_input_file, *remote_use_stdin)
+				spec_sources, rgerr := localfile.ChooseSpecSources(remote_input_files, *remote_input_dir, *remote_use_stdin)
 				if rgerr != nil {
 					cli.HandleCommandRGerror(rgerr, usage, description, remote_flag_set)
 				}
-				cli.HandleCommandRGerror(
-					remote.CLIReact(input_file, *username, os.Args[3], *port),
-					usage,
-					description,
-					remote_flag_set,
-				)
+				exit_code, rgerr := remote.CLIReact(spec_sources, *username, os.Args[3], *port, remote_options())
+				cli.HandleCommandResult(exit_code, rgerr, usage, description, remote_flag_set)
 			},
 		},
 		{
@@ -123,16 +212,12 @@ func main() {
 				usage := "regulator run local [ACTION NAME] [FLAGS]"
 				description := "Run an action on the local system"
 				cli.ShouldHaveArgs(3, usage, description, local_flag_set)
-				input_file, rgerr := localfile.ChooseFileOrStdin(*local_input_file, *local_use_stdin)
+				spec_sources, rgerr := localfile.ChooseSpecSources(local_input_files, *local_input_dir, *local_use_stdin)
 				if rgerr != nil {
 					cli.HandleCommandRGerror(rgerr, usage, description, local_flag_set)
 				}
-				cli.HandleCommandRGerror(
-					local.CLIRun(input_file, os.Args[3]),
-					usage,
-					description,
-					local_flag_set,
-				)
+				exit_code, rgerr := local.CLIRun(spec_sources, os.Args[3], local.RunOptions{Default_Timeout: *local_timeout, Fail_On: *local_fail_on, Selector: local_selector(), Render: local_render()})
+				cli.HandleCommandResult(exit_code, rgerr, usage, description, local_flag_set)
 			},
 		},
 		{
@@ -142,16 +227,12 @@ func main() {
 				usage := "regulator run remote [ACTION NAME] [TARGET] [FLAGS]"
 				description := "Run actions on a target"
 				cli.ShouldHaveArgs(4, usage, description, remote_flag_set)
-				input_file, rgerr := localfile.ChooseFileOrStdin(*remote_input_file, *remote_use_stdin)
+				spec_sources, rgerr := localfile.ChooseSpecSources(remote_input_files, *remote_input_dir, *remote_use_stdin)
 				if rgerr != nil {
 					cli.HandleCommandRGerror(rgerr, usage, description, remote_flag_set)
 				}
-				cli.HandleCommandRGerror(
-					remote.CLIRun(input_file, os.Args[3], *username, os.Args[4], *port),
-					usage,
-					description,
-					remote_flag_set,
-				)
+				exit_code, rgerr := remote.CLIRun(spec_sources, os.Args[3], *username, os.Args[4], *port, remote_options())
+				cli.HandleCommandResult(exit_code, rgerr, usage, description, remote_flag_set)
 			},
 		},
 		{
@@ -162,13 +243,32 @@ func main() {
 				description := "Run actions on a target"
 				cli.ShouldHaveArgs(3, usage, description, setup_flag_set)
 				cli.HandleCommandRGerror(
-					remote.CLISetup(*setup_username, os.Args[3], *setup_port),
+					remote.CLISetup(*setup_username, os.Args[3], *setup_port, *setup_session_timeout),
 					usage,
 					description,
 					setup_flag_set,
 				)
 			},
 		},
+		{
+			Verb: "validate",
+			Noun: "local",
+			ExecutionFn: func() {
+				usage := "regulator validate local [FLAGS]"
+				description := "Check that a spec is valid and everything it refers to exists, without running anything"
+				cli.ShouldHaveArgs(2, usage, description, local_flag_set)
+				spec_sources, rgerr := localfile.ChooseSpecSources(local_input_files, *local_input_dir, *local_use_stdin)
+				if rgerr != nil {
+					cli.HandleCommandRGerror(rgerr, usage, description, local_flag_set)
+				}
+				cli.HandleCommandRGerror(
+					local.CLIValidate(spec_sources),
+					usage,
+					description,
+					local_flag_set,
+				)
+			},
+		},
 	}
 
 	cli.RunCommand("regulator", command_list)
@@ -4,51 +4,62 @@ import (
 	"fmt"
 
 	"github.com/puppetlabs/regulator/connection"
-	"github.com/puppetlabs/regulator/localfile"
+	"github.com/puppetlabs/regulator/exitcode"
+	"github.com/puppetlabs/regulator/operparse"
 	"github.com/puppetlabs/regulator/rgerror"
 	"github.com/puppetlabs/regulator/validator"
 )
 
-func Run(raw_data []byte, actn_name string, username string, target string, port string) (string, *rgerror.RGerror) {
-	rgerr := validator.ValidateParams(fmt.Sprintf(
-		`[
-			{"name":"action name","value":"%s","validate":["NotEmpty"]},
-			{"name":"username","value":"%s","validate":["NotEmpty"]},
-			{"name":"target","value":"%s","validate":["NotEmpty"]},
-			{"name":"port","value":"%s","validate":["NotEmpty","IsNumber"]}
-		 ]`,
-		actn_name,
-		username,
-		target,
-		port,
-	))
+// The action name is checked here as well as by the parser, since the spec
+// sent to the remote regulator might not have come from it
+var action_name_rule validator.Rule = validator.MatchesRegex(operparse.ACTION_NAME_PATTERN, "a valid action name")
+
+// Returns the remote regulator's exit code, see the exitcode package
+func RunWithOptions(raw_data []byte, actn_name string, username string, target string, port string, opts Options) (string, int, *rgerror.RGerror) {
+	rgerr := validator.Validate(
+		validator.Param{Name: "action name", Value: actn_name, Rules: []validator.Rule{validator.NotEmpty, action_name_rule}},
+		validator.Param{Name: "username", Value: username, Rules: []validator.Rule{validator.NotEmpty}},
+		validator.Param{Name: "target", Value: target, Rules: []validator.Rule{validator.NotEmpty, validator.IsHost}},
+		validator.Param{Name: "port", Value: port, Rules: []validator.Rule{validator.NotEmpty, validator.IsPort}},
+	)
 	if rgerr != nil {
-		return "", rgerr
+		return "", exitcode.ForError(rgerr), rgerr
 	}
-	command := fmt.Sprintf("$HOME/.regulator/bin/regulator run local \"%s\" --stdin", actn_name)
-	sout, serr, ec, rgerr := connection.RunSSHCommand(command, string(raw_data), username, target, port)
+	timeout, rgerr := parseSessionTimeout(opts.Session_Timeout)
 	if rgerr != nil {
-		return sout, &rgerror.RGerror{
-			Kind: rgerror.RemoteExecError,
-			Message: fmt.Sprintf("regulator client on remote target returned non-zero exit code %d\n\nStdout:\n%s\nStderr:\n%s\n",
-				ec,
-				sout,
-				serr),
-			Origin: rgerr.Origin,
-		}
+		return "", exitcode.ForError(rgerr), rgerr
 	}
-	return sout, nil
+	command := regulatorCommand("run local "+shellQuote(actn_name), opts)
+	sout, serr, ec, rgerr := connection.RunSSHCommand(command, string(raw_data), username, target, port, timeout)
+	// The remote regulator exiting with a result code isn't an error, its
+	// results were still printed
+	if rgerr != nil && !exitcode.IsResultCode(ec) {
+		rgerr = remoteError(rgerr, sout, serr, ec, opts)
+		return sout, exitcode.ForError(rgerr), rgerr
+	}
+	return sout, ec, nil
+}
+
+// Deprecated: use RunWithOptions, this runs with the default options. A
+// failed action is no longer an error, it's in the results.
+func Run(raw_data []byte, actn_name string, username string, target string, port string) (string, *rgerror.RGerror) {
+	sout, _, rgerr := RunWithOptions(raw_data, actn_name, username, target, port, Options{})
+	return sout, rgerr
 }
 
-func CLIRun(maybe_file string, actn_name string, username string, target string, port string) *rgerror.RGerror {
-	raw_data, rgerr := localfile.ReadFileOrStdin(maybe_file)
+func CLIRun(spec_sources []string, actn_name string, username string, target string, port string, opts Options) (int, *rgerror.RGerror) {
+	rgerr := checkOptions(opts)
+	if rgerr != nil {
+		return exitcode.ForError(rgerr), rgerr
+	}
+	raw_data, rgerr := loadSpecForRemote(spec_sources, opts, actn_name, false)
 	if rgerr != nil {
-		return rgerr
+		return exitcode.ForError(rgerr), rgerr
 	}
-	sout, rgerr := Run(raw_data, actn_name, username, target, port)
+	sout, exit_code, rgerr := RunWithOptions(raw_data, actn_name, username, target, port, opts)
 	if rgerr != nil {
-		return rgerr
+		return exit_code, rgerr
 	}
 	fmt.Printf("%s", sout)
-	return nil
+	return exit_code, nil
 }
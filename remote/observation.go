@@ -4,48 +4,57 @@ import (
 	"fmt"
 
 	"github.com/puppetlabs/regulator/connection"
-	"github.com/puppetlabs/regulator/localfile"
+	"github.com/puppetlabs/regulator/exitcode"
 	"github.com/puppetlabs/regulator/rgerror"
 	"github.com/puppetlabs/regulator/validator"
 )
 
-func Observe(raw_data []byte, username string, target string, port string) (string, *rgerror.RGerror) {
-	rgerr := validator.ValidateParams(fmt.Sprintf(
-		`[
-			{"name":"username","value":"%s","validate":["NotEmpty"]},
-			{"name":"target","value":"%s","validate":["NotEmpty"]},
-			{"name":"port","value":"%s","validate":["NotEmpty","IsNumber"]}
-		 ]`,
-		username,
-		target,
-		port,
-	))
+// Returns the remote regulator's exit code, see the exitcode package
+func ObserveWithOptions(raw_data []byte, username string, target string, port string, opts Options) (string, int, *rgerror.RGerror) {
+	rgerr := validator.Validate(
+		validator.Param{Name: "username", Value: username, Rules: []validator.Rule{validator.NotEmpty}},
+		validator.Param{Name: "target", Value: target, Rules: []validator.Rule{validator.NotEmpty, validator.IsHost}},
+		validator.Param{Name: "port", Value: port, Rules: []validator.Rule{validator.NotEmpty, validator.IsPort}},
+	)
 	if rgerr != nil {
-		return "", rgerr
+		return "", exitcode.ForError(rgerr), rgerr
 	}
-	sout, serr, ec, rgerr := connection.RunSSHCommand("$HOME/.regulator/bin/regulator observe local --stdin", string(raw_data), username, target, port)
+	timeout, rgerr := parseSessionTimeout(opts.Session_Timeout)
 	if rgerr != nil {
-		return sout, &rgerror.RGerror{
-			Kind: rgerror.RemoteExecError,
-			Message: fmt.Sprintf("regulator client on remote target returned non-zero exit code %d\n\nStdout:\n%s\nStderr:\n%s\n",
-				ec,
-				sout,
-				serr),
-			Origin: rgerr.Origin,
-		}
+		return "", exitcode.ForError(rgerr), rgerr
+	}
+	command := regulatorCommand("observe local", opts) + parallelismFlag(opts.Parallelism)
+	sout, serr, ec, rgerr := connection.RunSSHCommand(command, string(raw_data), username, target, port, timeout)
+	// The remote regulator exiting with a result code isn't an error, its
+	// results were still printed
+	if rgerr != nil && !exitcode.IsResultCode(ec) {
+		rgerr = remoteError(rgerr, sout, serr, ec, opts)
+		return sout, exitcode.ForError(rgerr), rgerr
 	}
-	return sout, nil
+	return sout, ec, nil
 }
 
-func CLIObserve(maybe_file string, username string, target string, port string) *rgerror.RGerror {
-	raw_data, rgerr := localfile.ReadFileOrStdin(maybe_file)
+// Deprecated: use ObserveWithOptions, this runs with the default options.
+// Failed or unexpected results are no longer errors, they're in the
+// results.
+func Observe(raw_data []byte, username string, target string, port string) (string, *rgerror.RGerror) {
+	sout, _, rgerr := ObserveWithOptions(raw_data, username, target, port, Options{})
+	return sout, rgerr
+}
+
+func CLIObserve(spec_sources []string, username string, target string, port string, opts Options) (int, *rgerror.RGerror) {
+	rgerr := checkOptions(opts)
+	if rgerr != nil {
+		return exitcode.ForError(rgerr), rgerr
+	}
+	raw_data, rgerr := loadSpecForRemote(spec_sources, opts, "", true)
 	if rgerr != nil {
-		return rgerr
+		return exitcode.ForError(rgerr), rgerr
 	}
-	sout, rgerr := Observe(raw_data, username, target, port)
+	sout, exit_code, rgerr := ObserveWithOptions(raw_data, username, target, port, opts)
 	if rgerr != nil {
-		return rgerr
+		return exit_code, rgerr
 	}
 	fmt.Printf("%s", sout)
-	return nil
+	return exit_code, nil
 }
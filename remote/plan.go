@@ -0,0 +1,52 @@
+package remote
+
+import (
+	"fmt"
+
+	"github.com/puppetlabs/regulator/connection"
+	"github.com/puppetlabs/regulator/exitcode"
+	"github.com/puppetlabs/regulator/rgerror"
+	"github.com/puppetlabs/regulator/validator"
+)
+
+// Returns the remote regulator's exit code, see the exitcode package
+func PlanWithOptions(raw_data []byte, username string, target string, port string, opts Options) (string, int, *rgerror.RGerror) {
+	rgerr := validator.Validate(
+		validator.Param{Name: "username", Value: username, Rules: []validator.Rule{validator.NotEmpty}},
+		validator.Param{Name: "target", Value: target, Rules: []validator.Rule{validator.NotEmpty, validator.IsHost}},
+		validator.Param{Name: "port", Value: port, Rules: []validator.Rule{validator.NotEmpty, validator.IsPort}},
+	)
+	if rgerr != nil {
+		return "", exitcode.ForError(rgerr), rgerr
+	}
+	timeout, rgerr := parseSessionTimeout(opts.Session_Timeout)
+	if rgerr != nil {
+		return "", exitcode.ForError(rgerr), rgerr
+	}
+	command := regulatorCommand("plan local", opts) + parallelismFlag(opts.Parallelism)
+	sout, serr, ec, rgerr := connection.RunSSHCommand(command, string(raw_data), username, target, port, timeout)
+	// The remote regulator exiting with a result code isn't an error, its
+	// results were still printed
+	if rgerr != nil && !exitcode.IsResultCode(ec) {
+		rgerr = remoteError(rgerr, sout, serr, ec, opts)
+		return sout, exitcode.ForError(rgerr), rgerr
+	}
+	return sout, ec, nil
+}
+
+func CLIPlan(spec_sources []string, username string, target string, port string, opts Options) (int, *rgerror.RGerror) {
+	rgerr := checkOptions(opts)
+	if rgerr != nil {
+		return exitcode.ForError(rgerr), rgerr
+	}
+	raw_data, rgerr := loadSpecForRemote(spec_sources, opts, "", false)
+	if rgerr != nil {
+		return exitcode.ForError(rgerr), rgerr
+	}
+	sout, exit_code, rgerr := PlanWithOptions(raw_data, username, target, port, opts)
+	if rgerr != nil {
+		return exit_code, rgerr
+	}
+	fmt.Printf("%s", sout)
+	return exit_code, nil
+}
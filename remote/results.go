@@ -0,0 +1,103 @@
+package remote
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/puppetlabs/regulator/operation"
+	"github.com/puppetlabs/regulator/render"
+	"github.com/puppetlabs/regulator/rgerror"
+)
+
+// The same as ObserveWithOptions, ReactWithOptions, PlanWithOptions, and
+// RunWithOptions, for Go programs that want the remote regulator's results
+// as structs (like the engine package returns) rather than as printed. ops
+// is sent as it is, so like with the engine, timeouts and selection are up
+// to the caller. opts.Render is ignored, the remote regulator always
+// answers in JSON, and the results say whether anything failed so its
+// exit code isn't returned.
+func ObserveResults(ops *operation.Operations, username string, target string, port string, opts Options) (*operation.ObservationResults, *rgerror.RGerror) {
+	raw_data, rgerr := render.RenderJson(ops)
+	if rgerr != nil {
+		return nil, rgerr
+	}
+	sout, _, rgerr := ObserveWithOptions([]byte(raw_data), username, target, port, resultsOptions(opts))
+	if rgerr != nil {
+		return nil, rgerr
+	}
+	var results operation.ObservationResults
+	rgerr = parseResults(sout, &results)
+	if rgerr != nil {
+		return nil, rgerr
+	}
+	return &results, nil
+}
+
+func ReactResults(ops *operation.Operations, username string, target string, port string, opts Options) (*operation.ReactionResults, *rgerror.RGerror) {
+	raw_data, rgerr := render.RenderJson(ops)
+	if rgerr != nil {
+		return nil, rgerr
+	}
+	sout, _, rgerr := ReactWithOptions([]byte(raw_data), username, target, port, resultsOptions(opts))
+	if rgerr != nil {
+		return nil, rgerr
+	}
+	var results operation.ReactionResults
+	rgerr = parseResults(sout, &results)
+	if rgerr != nil {
+		return nil, rgerr
+	}
+	return &results, nil
+}
+
+func PlanResults(ops *operation.Operations, username string, target string, port string, opts Options) (*operation.ReactionResults, *rgerror.RGerror) {
+	raw_data, rgerr := render.RenderJson(ops)
+	if rgerr != nil {
+		return nil, rgerr
+	}
+	sout, _, rgerr := PlanWithOptions([]byte(raw_data), username, target, port, resultsOptions(opts))
+	if rgerr != nil {
+		return nil, rgerr
+	}
+	var results operation.ReactionResults
+	rgerr = parseResults(sout, &results)
+	if rgerr != nil {
+		return nil, rgerr
+	}
+	return &results, nil
+}
+
+func RunResults(ops *operation.Operations, actn_name string, username string, target string, port string, opts Options) (*operation.ActionResults, *rgerror.RGerror) {
+	raw_data, rgerr := render.RenderJson(ops)
+	if rgerr != nil {
+		return nil, rgerr
+	}
+	sout, _, rgerr := RunWithOptions([]byte(raw_data), actn_name, username, target, port, resultsOptions(opts))
+	if rgerr != nil {
+		return nil, rgerr
+	}
+	var results operation.ActionResults
+	rgerr = parseResults(sout, &results)
+	if rgerr != nil {
+		return nil, rgerr
+	}
+	return &results, nil
+}
+
+func resultsOptions(opts Options) Options {
+	opts.Render = render.Options{Format: render.FORMAT_JSON}
+	return opts
+}
+
+func parseResults(sout string, results interface{}) *rgerror.RGerror {
+	err := json.Unmarshal([]byte(sout), results)
+	if err != nil {
+		return &rgerror.RGerror{
+			Kind:    rgerror.RemoteExecError,
+			Message: fmt.Sprintf("Could not parse the results from the remote regulator: %s\n\nStdout:\n%s\n", err, sout),
+			Origin:  err,
+			Hint:    "The remote regulator may be older than this one, update it with 'regulator setup remote [TARGET]'",
+		}
+	}
+	return nil
+}
@@ -11,17 +11,18 @@ import (
 	"github.com/puppetlabs/regulator/version"
 )
 
-func Setup(username string, target string, port string) (string, string, *rgerror.RGerror) {
-	rgerr := validator.ValidateParams(fmt.Sprintf(
-		`[
-			{"name":"username","value":"%s","validate":["NotEmpty"]},
-			{"name":"target","value":"%s","validate":["NotEmpty"]},
-			{"name":"port","value":"%s","validate":["NotEmpty","IsNumber"]}
-		 ]`,
-		username,
-		target,
-		port,
-	))
+// session_timeout is the same as --session-timeout, an empty string means
+// setup can take as long as it needs
+func SetupWithTimeout(username string, target string, port string, session_timeout string) (string, string, *rgerror.RGerror) {
+	rgerr := validator.Validate(
+		validator.Param{Name: "username", Value: username, Rules: []validator.Rule{validator.NotEmpty}},
+		validator.Param{Name: "target", Value: target, Rules: []validator.Rule{validator.NotEmpty, validator.IsHost}},
+		validator.Param{Name: "port", Value: port, Rules: []validator.Rule{validator.NotEmpty, validator.IsPort}},
+	)
+	if rgerr != nil {
+		return "", "", rgerr
+	}
+	timeout, rgerr := parseSessionTimeout(session_timeout)
 	if rgerr != nil {
 		return "", "", rgerr
 	}
@@ -33,8 +34,11 @@ func Setup(username string, target string, port string) (string, string, *rgerro
 		chmod 755 $HOME/.regulator/bin/regulator 1>&2`,
 		version.VERSION,
 	)
-	sout, serr, ec, rgerr := connection.RunSSHCommand(command, "", username, target, port)
+	sout, serr, ec, rgerr := connection.RunSSHCommand(command, "", username, target, port, timeout)
 	if rgerr != nil {
+		if rgerr.Kind == rgerror.TimeoutError {
+			return "", "", rgerr
+		}
 		return "", "", &rgerror.RGerror{
 			Kind: rgerror.RemoteExecError,
 			Message: fmt.Sprintf("regulator client on remote target returned non-zero exit code %d\n\nStdout:\n%s\nStderr:\n%s\n",
@@ -47,8 +51,13 @@ func Setup(username string, target string, port string) (string, string, *rgerro
 	return sout, serr, nil
 }
 
-func CLISetup(username string, target string, port string) *rgerror.RGerror {
-	_, serr, rgerr := Setup(username, target, port)
+// Deprecated: use SetupWithTimeout, this never times out
+func Setup(username string, target string, port string) (string, string, *rgerror.RGerror) {
+	return SetupWithTimeout(username, target, port, "")
+}
+
+func CLISetup(username string, target string, port string, session_timeout string) *rgerror.RGerror {
+	_, serr, rgerr := SetupWithTimeout(username, target, port, session_timeout)
 	if rgerr != nil {
 		return rgerr
 	}
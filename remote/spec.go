@@ -0,0 +1,185 @@
+package remote
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/puppetlabs/regulator/exitcode"
+	"github.com/puppetlabs/regulator/localexec"
+	"github.com/puppetlabs/regulator/operation"
+	"github.com/puppetlabs/regulator/operparse"
+	"github.com/puppetlabs/regulator/render"
+	"github.com/puppetlabs/regulator/rgerror"
+)
+
+// Settings from the command line for running the remote regulator
+type Options struct {
+	// From --timeout, see loadSpecForRemote
+	Default_Timeout string
+	// From --session-timeout, see parseSessionTimeout
+	Session_Timeout string
+	// From --parallelism, passed on to the remote regulator
+	Parallelism int
+	// From --noop, passed on to the remote regulator when reacting
+	Noop bool
+	// From --become and --become-exe, see regulatorCommand
+	Become     bool
+	Become_Exe string
+	// From --fail-on, passed on to the remote regulator whose exit code
+	// is then ours
+	Fail_On string
+	// From --only, --skip, and --tags, see loadSpecForRemote
+	Selector operation.Selector
+	// From --format, --pretty, and --color, passed on to the remote
+	// regulator so it prints its results the way we would
+	Render render.Options
+}
+
+// Checks the options that don't need a spec or the target, so a bad flag
+// is reported before connecting
+func checkOptions(opts Options) *rgerror.RGerror {
+	rgerr := exitcode.CheckFailOn(opts.Fail_On)
+	if rgerr != nil {
+		return rgerr
+	}
+	return render.CheckOptions(opts.Render)
+}
+
+// Where setup installs regulator on the target
+var REMOTE_REGULATOR_PATH string = "$HOME/.regulator/bin/regulator"
+
+// The command that runs the remote regulator, reading the spec from stdin.
+// With --become the remote regulator (and so everything it runs) runs as
+// root through the escalation command, while still being installed in the
+// ssh user's home: $HOME is expanded by the ssh user's shell first.
+func regulatorCommand(subcommand string, opts Options) string {
+	command := REMOTE_REGULATOR_PATH + " " + subcommand + " --stdin"
+	// Like --parallelism, only passed when it isn't the default
+	if opts.Fail_On != "" && opts.Fail_On != exitcode.FAIL_ON_FAILED {
+		command += " --fail-on " + opts.Fail_On
+	}
+	if opts.Render.Format != "" && opts.Render.Format != render.FORMAT_JSON {
+		command += " --format " + opts.Render.Format
+	}
+	if opts.Render.Pretty {
+		command += " --pretty"
+	}
+	// The remote regulator's stdout is the ssh session, not a terminal, so
+	// whether to color is decided here where the results end up
+	if opts.Render.Format == render.FORMAT_TABLE && render.UseColor(opts.Render.Color) {
+		command += " --color " + render.COLOR_ALWAYS
+	}
+	if opts.Become {
+		command = shellQuote(opts.Become_Exe) + " -n -- " + command
+	}
+	return command
+}
+
+// Quotes value so the remote shell passes it on as a single argument,
+// exactly as it is
+func shellQuote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// Errors from the ssh session, with a clearer one when --become needed a
+// password, and hints for the common ways running the remote regulator
+// goes wrong
+func remoteError(rgerr *rgerror.RGerror, sout string, serr string, ec int, opts Options) *rgerror.RGerror {
+	if rgerr.Kind == rgerror.TimeoutError {
+		return &rgerror.RGerror{
+			Kind:    rgerr.Kind,
+			Message: rgerr.Message,
+			Origin:  rgerr.Origin,
+			Hint:    "Raise --session-timeout, or use --timeout to kill observations and actions that hang",
+		}
+	}
+	if opts.Become && localexec.BecomeNeedsPassword(opts.Become_Exe, serr) {
+		return &rgerror.RGerror{
+			Kind: rgerror.EscalationError,
+			Message: fmt.Sprintf("'%s' on the remote target asked for a password and regulator can't give one\n\nStderr:\n%s\n",
+				opts.Become_Exe,
+				serr),
+			Origin: rgerr.Origin,
+			Hint:   fmt.Sprintf("The ssh user must be able to use '%s' without a password (e.g. NOPASSWD in sudoers)", opts.Become_Exe),
+		}
+	}
+	hint := ""
+	// What shells exit with when they can't find the command
+	if ec == 127 {
+		hint = "regulator may not be installed on the target, install it with 'regulator setup remote [TARGET]'"
+	}
+	return &rgerror.RGerror{
+		Kind: rgerror.RemoteExecError,
+		Message: fmt.Sprintf("regulator client on remote target returned non-zero exit code %d\n\nStdout:\n%s\nStderr:\n%s\n",
+			ec,
+			sout,
+			serr),
+		Origin: rgerr.Origin,
+		Hint:   hint,
+	}
+}
+
+// The remote target doesn't have our spec files, so every source (and
+// anything they include) is loaded and merged locally, then sent to the
+// remote regulator as a single spec on stdin. JSON is valid yaml, and
+// unlike yaml it keeps the difference between unset and empty lists.
+//
+// The --timeout default is filled in here too, and only the operations
+// picked out by --only, --skip, and --tags are sent, so the remote
+// regulator doesn't need to be told about either. actn_name is the action
+// being run, if any, which has to be selected too. observe_only is the
+// same as for local's loadSpecs.
+func loadSpecForRemote(spec_sources []string, opts Options, actn_name string, observe_only bool) ([]byte, *rgerror.RGerror) {
+	data, rgerr := operparse.LoadSpecs(spec_sources)
+	if rgerr != nil {
+		return nil, rgerr
+	}
+	rgerr = operparse.ApplyDefaultTimeout(data, opts.Default_Timeout)
+	if rgerr != nil {
+		return nil, rgerr
+	}
+	if observe_only {
+		data, rgerr = operparse.SelectObservations(data, opts.Selector)
+	} else {
+		data, rgerr = operparse.SelectOperations(data, opts.Selector)
+	}
+	if rgerr != nil {
+		return nil, rgerr
+	}
+	if actn_name != "" {
+		rgerr = operparse.CheckActionSelected(actn_name, data, opts.Selector)
+		if rgerr != nil {
+			return nil, rgerr
+		}
+	}
+	raw_data, rgerr := render.RenderJson(data)
+	if rgerr != nil {
+		return nil, rgerr
+	}
+	return []byte(raw_data), nil
+}
+
+// The --parallelism flag to pass on to the remote regulator. Nothing is
+// passed for the default of running one observation at a time, so targets
+// set up with an older regulator keep working.
+func parallelismFlag(parallelism int) string {
+	if parallelism > 1 {
+		return fmt.Sprintf(" --parallelism %d", parallelism)
+	}
+	return ""
+}
+
+// How long a whole ssh session can run, from --session-timeout. An empty
+// string means it can run forever.
+func parseSessionTimeout(session_timeout string) (time.Duration, *rgerror.RGerror) {
+	timeout, err := operparse.ParseTimeout(session_timeout)
+	if err != nil {
+		return 0, &rgerror.RGerror{
+			Kind:    rgerror.InvalidInput,
+			Message: fmt.Sprintf("Invalid --session-timeout: %s", err),
+			Origin:  err,
+		}
+	}
+	return timeout, nil
+}
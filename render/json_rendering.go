@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 
+	"github.com/puppetlabs/regulator/operation"
 	"github.com/puppetlabs/regulator/rgerror"
 )
 
@@ -18,3 +19,39 @@ func RenderJson(data interface{}) (string, *rgerror.RGerror) {
 	}
 	return string(json_output), nil
 }
+
+// Indented for people to read, and ending in a newline unlike RenderJson
+func RenderPrettyJson(data interface{}) (string, *rgerror.RGerror) {
+	json_output, json_err := json.MarshalIndent(data, "", "  ")
+	if json_err != nil {
+		return "", &rgerror.RGerror{
+			Kind:    rgerror.ExecError,
+			Message: fmt.Sprintf("Could not render result as JSON: %s\n", json_err),
+			Origin:  json_err,
+		}
+	}
+	return string(json_output) + "\n", nil
+}
+
+type jsonRenderer struct {
+	pretty bool
+}
+
+func (rndr jsonRenderer) render(data interface{}) (string, *rgerror.RGerror) {
+	if rndr.pretty {
+		return RenderPrettyJson(data)
+	}
+	return RenderJson(data)
+}
+
+func (rndr jsonRenderer) RenderObservations(results *operation.ObservationResults) (string, *rgerror.RGerror) {
+	return rndr.render(results)
+}
+
+func (rndr jsonRenderer) RenderReactions(results *operation.ReactionResults) (string, *rgerror.RGerror) {
+	return rndr.render(results)
+}
+
+func (rndr jsonRenderer) RenderActions(results *operation.ActionResults) (string, *rgerror.RGerror) {
+	return rndr.render(results)
+}
@@ -0,0 +1,211 @@
+package render
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/puppetlabs/regulator/operation"
+	"github.com/puppetlabs/regulator/rgerror"
+)
+
+// JUnit XML, which most CI systems can show as a test report. Every
+// observation, reaction, and action is a test case, in a test suite for
+// each kind. Unexpected observations and failed reactions and actions are
+// failures, observations that failed to run are errors, and skipped
+// reactions are skipped.
+type junitRenderer struct{}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Skipped  int              `xml:"skipped,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Skipped   int             `xml:"skipped,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr,omitempty"`
+	Hostname  string          `xml:"hostname,attr,omitempty"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitProblem `xml:"failure,omitempty"`
+	Error     *junitProblem `xml:"error,omitempty"`
+	Skipped   *junitProblem `xml:"skipped,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+	SystemErr string        `xml:"system-err,omitempty"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr,omitempty"`
+	Details string `xml:",chardata"`
+}
+
+func (rndr junitRenderer) RenderObservations(results *operation.ObservationResults) (string, *rgerror.RGerror) {
+	suite := observationSuite(results.Observations, results.RunTiming)
+	return renderJunit([]junitTestSuite{suite}, results.Duration_Ms)
+}
+
+func (rndr junitRenderer) RenderReactions(results *operation.ReactionResults) (string, *rgerror.RGerror) {
+	suites := []junitTestSuite{
+		observationSuite(results.Observations, results.RunTiming),
+		reactionSuite(results),
+	}
+	return renderJunit(suites, results.Duration_Ms)
+}
+
+func (rndr junitRenderer) RenderActions(results *operation.ActionResults) (string, *rgerror.RGerror) {
+	suite := junitTestSuite{Name: "actions"}
+	var total_ms int64
+	for _, name := range actionNames(results.Actions) {
+		result := results.Actions[name]
+		status := actionStatus(result)
+		test_case := junitTestCase{
+			Name:      name,
+			Classname: "regulator.actions",
+			Time:      seconds(result.Duration_Ms),
+			SystemOut: result.Output,
+			SystemErr: result.Logs,
+		}
+		if isFailure(status) {
+			test_case.Failure = &junitProblem{Message: fmt.Sprintf("Action %s", status), Type: status}
+		}
+		total_ms += result.Duration_Ms
+		if suite.Hostname == "" {
+			suite.Hostname = result.Hostname
+		}
+		suite.add(test_case)
+	}
+	suite.Time = seconds(total_ms)
+	return renderJunit([]junitTestSuite{suite}, total_ms)
+}
+
+func observationSuite(observations map[string]operation.ObservationResult, timing operation.RunTiming) junitTestSuite {
+	suite := junitTestSuite{
+		Name:      "observations",
+		Timestamp: junitTimestamp(timing.Started_At),
+		Hostname:  timing.Hostname,
+	}
+	var total_ms int64
+	for _, name := range observationNames(observations) {
+		result := observations[name]
+		status := observationStatus(result)
+		test_case := junitTestCase{
+			Name:      name,
+			Classname: "regulator.observations",
+			Time:      seconds(result.Duration_Ms),
+			SystemOut: result.Result,
+			SystemErr: result.Logs,
+		}
+		if status == STATUS_UNEXPECTED {
+			test_case.Failure = &junitProblem{
+				Message: fmt.Sprintf("Observation result '%s' was not what was expected", summarize(result.Result, TABLE_SUMMARY_LENGTH)),
+				Type:    status,
+			}
+		} else if isFailure(status) {
+			test_case.Error = &junitProblem{Message: summarize(result.Result, TABLE_SUMMARY_LENGTH), Type: status, Details: result.Result}
+		}
+		total_ms += result.Duration_Ms
+		suite.add(test_case)
+	}
+	suite.Time = seconds(total_ms)
+	return suite
+}
+
+func reactionSuite(results *operation.ReactionResults) junitTestSuite {
+	suite := junitTestSuite{
+		Name:      "reactions",
+		Timestamp: junitTimestamp(results.Started_At),
+		Hostname:  results.Hostname,
+	}
+	var total_ms int64
+	for _, name := range reactionNames(results) {
+		result := results.Reactions[name]
+		status := reactionStatus(result)
+		test_case := junitTestCase{
+			Name:      name,
+			Classname: "regulator.reactions",
+			Time:      seconds(result.Duration_Ms),
+			SystemOut: strings.TrimSpace(result.Message + "\n" + result.Output),
+			SystemErr: result.Logs,
+		}
+		if status == STATUS_SKIPPED {
+			test_case.Skipped = &junitProblem{Message: result.Message}
+		} else if isFailure(status) {
+			test_case.Failure = &junitProblem{Message: result.Message, Type: status}
+		}
+		total_ms += result.Duration_Ms
+		suite.add(test_case)
+	}
+	suite.Time = seconds(total_ms)
+	return suite
+}
+
+func (suite *junitTestSuite) add(test_case junitTestCase) {
+	suite.Cases = append(suite.Cases, test_case)
+	suite.Tests++
+	if test_case.Failure != nil {
+		suite.Failures++
+	}
+	if test_case.Error != nil {
+		suite.Errors++
+	}
+	if test_case.Skipped != nil {
+		suite.Skipped++
+	}
+}
+
+func renderJunit(suites []junitTestSuite, duration_ms int64) (string, *rgerror.RGerror) {
+	all_suites := junitTestSuites{
+		Name:   "regulator",
+		Time:   seconds(duration_ms),
+		Suites: suites,
+	}
+	for _, suite := range suites {
+		all_suites.Tests += suite.Tests
+		all_suites.Failures += suite.Failures
+		all_suites.Errors += suite.Errors
+		all_suites.Skipped += suite.Skipped
+	}
+	xml_output, xml_err := xml.MarshalIndent(all_suites, "", "  ")
+	if xml_err != nil {
+		return "", &rgerror.RGerror{
+			Kind:    rgerror.ExecError,
+			Message: fmt.Sprintf("Could not render result as JUnit XML: %s\n", xml_err),
+			Origin:  xml_err,
+		}
+	}
+	return xml.Header + string(xml_output) + "\n", nil
+}
+
+func seconds(duration_ms int64) string {
+	return fmt.Sprintf("%.3f", duration(duration_ms).Seconds())
+}
+
+// JUnit timestamps don't have a timezone or fractional seconds
+func junitTimestamp(started_at string) string {
+	if started_at == "" {
+		return ""
+	}
+	parsed, err := time.Parse(time.RFC3339Nano, started_at)
+	if err != nil {
+		return ""
+	}
+	return parsed.UTC().Format("2006-01-02T15:04:05")
+}
@@ -0,0 +1,111 @@
+package render
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/puppetlabs/regulator/operation"
+	"github.com/puppetlabs/regulator/rgerror"
+)
+
+// The --format choices for printing results
+var FORMAT_JSON string = "json"
+var FORMAT_YAML string = "yaml"
+var FORMAT_TABLE string = "table"
+var FORMAT_JUNIT string = "junit"
+var FORMAT_TAP string = "tap"
+var FORMATS []string = []string{FORMAT_JSON, FORMAT_YAML, FORMAT_TABLE, FORMAT_JUNIT, FORMAT_TAP}
+
+// The --color choices. With auto the table is only colored when printed
+// straight to a terminal, and NO_COLOR isn't set.
+var COLOR_AUTO string = "auto"
+var COLOR_ALWAYS string = "always"
+var COLOR_NEVER string = "never"
+var COLOR_MODES []string = []string{COLOR_AUTO, COLOR_ALWAYS, COLOR_NEVER}
+
+// How results should be printed, the zero value is the compact JSON
+// regulator has always printed
+type Options struct {
+	// One of FORMATS, json if empty
+	Format string
+	// Indent json output, the other formats ignore it
+	Pretty bool
+	// One of COLOR_MODES, auto if empty. Only the table is ever colored.
+	Color string
+}
+
+// Turns the results of each command in to what it prints. Every format
+// has to handle all of them so any command can be asked for any format.
+type Renderer interface {
+	// observe
+	RenderObservations(results *operation.ObservationResults) (string, *rgerror.RGerror)
+	// plan and react, results.Dry_Run is set for plan
+	RenderReactions(results *operation.ReactionResults) (string, *rgerror.RGerror)
+	// run
+	RenderActions(results *operation.ActionResults) (string, *rgerror.RGerror)
+}
+
+func CheckOptions(opts Options) *rgerror.RGerror {
+	if opts.Format != "" && !contains(FORMATS, opts.Format) {
+		return &rgerror.RGerror{
+			Kind:    rgerror.InvalidInput,
+			Message: fmt.Sprintf("Invalid --format '%s', must be one of: %s", opts.Format, strings.Join(FORMATS, ", ")),
+			Origin:  nil,
+		}
+	}
+	if opts.Color != "" && !contains(COLOR_MODES, opts.Color) {
+		return &rgerror.RGerror{
+			Kind:    rgerror.InvalidInput,
+			Message: fmt.Sprintf("Invalid --color '%s', must be one of: %s", opts.Color, strings.Join(COLOR_MODES, ", ")),
+			Origin:  nil,
+		}
+	}
+	return nil
+}
+
+func NewRenderer(opts Options) (Renderer, *rgerror.RGerror) {
+	rgerr := CheckOptions(opts)
+	if rgerr != nil {
+		return nil, rgerr
+	}
+	switch opts.Format {
+	case FORMAT_YAML:
+		return yamlRenderer{}, nil
+	case FORMAT_TABLE:
+		return tableRenderer{color: UseColor(opts.Color)}, nil
+	case FORMAT_JUNIT:
+		return junitRenderer{}, nil
+	case FORMAT_TAP:
+		return tapRenderer{}, nil
+	default:
+		return jsonRenderer{pretty: opts.Pretty}, nil
+	}
+}
+
+// Whether the table should be colored, see COLOR_MODES
+func UseColor(color_mode string) bool {
+	switch color_mode {
+	case COLOR_ALWAYS:
+		return true
+	case COLOR_NEVER:
+		return false
+	}
+	if _, no_color := os.LookupEnv("NO_COLOR"); no_color {
+		return false
+	}
+	stat, err := os.Stdout.Stat()
+	if err != nil {
+		return false
+	}
+	return stat.Mode()&os.ModeCharDevice != 0
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,127 @@
+package render
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/puppetlabs/regulator/operation"
+)
+
+// The one word summaries of a result that the table, JUnit, and TAP
+// formats are built around
+var STATUS_OK string = "ok"
+var STATUS_FAILED string = "failed"
+var STATUS_TIMED_OUT string = "timed out"
+var STATUS_UNEXPECTED string = "unexpected"
+var STATUS_SKIPPED string = "skipped"
+var STATUS_WOULD_RUN string = "would run"
+var STATUS_WOULD_CHANGE string = "would change"
+var STATUS_NO_CHANGE string = "no change"
+
+// A failed observation is unexpected as well, so failing is checked first
+func observationStatus(result operation.ObservationResult) string {
+	if result.Timed_Out {
+		return STATUS_TIMED_OUT
+	}
+	if !result.Succeeded {
+		return STATUS_FAILED
+	}
+	if !result.Expected {
+		return STATUS_UNEXPECTED
+	}
+	return STATUS_OK
+}
+
+func reactionStatus(result operation.ReactionResult) string {
+	if result.Skipped {
+		return STATUS_SKIPPED
+	}
+	if result.Timed_Out {
+		return STATUS_TIMED_OUT
+	}
+	if !result.Succeeded {
+		return STATUS_FAILED
+	}
+	if result.Would_Change != nil {
+		if *result.Would_Change {
+			return STATUS_WOULD_CHANGE
+		}
+		return STATUS_NO_CHANGE
+	}
+	if result.Would_Run != nil {
+		return STATUS_WOULD_RUN
+	}
+	return STATUS_OK
+}
+
+func actionStatus(result operation.ActionResult) string {
+	if result.Timed_Out {
+		return STATUS_TIMED_OUT
+	}
+	if !result.Succeeded {
+		return STATUS_FAILED
+	}
+	return STATUS_OK
+}
+
+// Whether a status should count against the run in test reports.
+// Unexpected observations do even though they only change the exit code
+// with --fail-on unexpected, a test report has no way to say "a bit wrong".
+func isFailure(status string) bool {
+	return status == STATUS_FAILED || status == STATUS_TIMED_OUT || status == STATUS_UNEXPECTED
+}
+
+func observationNames(observations map[string]operation.ObservationResult) []string {
+	names := make([]string, 0, len(observations))
+	for name := range observations {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// In the order they ran, followed by any that somehow aren't in
+// Reaction_Order
+func reactionNames(results *operation.ReactionResults) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, name := range results.Reaction_Order {
+		if _, found := results.Reactions[name]; found && !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	var rest []string
+	for name := range results.Reactions {
+		if !seen[name] {
+			rest = append(rest, name)
+		}
+	}
+	sort.Strings(rest)
+	return append(names, rest...)
+}
+
+func actionNames(actions map[string]operation.ActionResult) []string {
+	names := make([]string, 0, len(actions))
+	for name := range actions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func duration(duration_ms int64) time.Duration {
+	return time.Duration(duration_ms) * time.Millisecond
+}
+
+// Squashes a result or output on to one line, cut down to max_length
+// characters, for places that only have room for a summary
+func summarize(text string, max_length int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) <= max_length {
+		return text
+	}
+	return string(runes[:max_length-3]) + "..."
+}
@@ -0,0 +1,181 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/puppetlabs/regulator/operation"
+	"github.com/puppetlabs/regulator/rgerror"
+)
+
+// How much of a result, output, or message fits in a table cell
+var TABLE_SUMMARY_LENGTH int = 60
+
+var ansi_reset string = "\x1b[0m"
+var status_colors map[string]string = map[string]string{
+	STATUS_OK:           "\x1b[32m",
+	STATUS_FAILED:       "\x1b[31m",
+	STATUS_TIMED_OUT:    "\x1b[31m",
+	STATUS_UNEXPECTED:   "\x1b[33m",
+	STATUS_SKIPPED:      "\x1b[90m",
+	STATUS_WOULD_RUN:    "\x1b[36m",
+	STATUS_WOULD_CHANGE: "\x1b[36m",
+	STATUS_NO_CHANGE:    "\x1b[90m",
+}
+
+// A table for people to read, one row per result with a summary of the
+// whole run at the bottom. Everything else about a result (logs, the
+// command that ran, ...) is only in the json and yaml formats.
+type tableRenderer struct {
+	color bool
+}
+
+func (rndr tableRenderer) RenderObservations(results *operation.ObservationResults) (string, *rgerror.RGerror) {
+	var output strings.Builder
+	output.WriteString(rndr.observationTable(results.Observations))
+	output.WriteString("\n")
+	output.WriteString(observationSummary(results.Observations))
+	output.WriteString(timingSummary(results.RunTiming))
+	return output.String(), nil
+}
+
+func (rndr tableRenderer) RenderReactions(results *operation.ReactionResults) (string, *rgerror.RGerror) {
+	var output strings.Builder
+	if results.Dry_Run {
+		output.WriteString("Plan only, no actions were run\n\n")
+	} else if results.Noop {
+		output.WriteString("Noop mode, only actions that support noop were run\n\n")
+	}
+	output.WriteString(rndr.observationTable(results.Observations))
+	output.WriteString("\n")
+	rows := make([][]string, 0, len(results.Reactions))
+	for _, name := range reactionNames(results) {
+		result := results.Reactions[name]
+		rows = append(rows, []string{
+			name,
+			reactionStatus(result),
+			result.Reaction.Action,
+			durationCell(result.Execution),
+			summarize(result.Message, TABLE_SUMMARY_LENGTH),
+		})
+	}
+	output.WriteString(rndr.table([]string{"REACTION", "STATUS", "ACTION", "DURATION", "MESSAGE"}, rows))
+	output.WriteString("\n")
+	output.WriteString(observationSummary(results.Observations))
+	output.WriteString(reactionSummary(results.Reactions))
+	output.WriteString(timingSummary(results.RunTiming))
+	return output.String(), nil
+}
+
+func (rndr tableRenderer) RenderActions(results *operation.ActionResults) (string, *rgerror.RGerror) {
+	rows := make([][]string, 0, len(results.Actions))
+	for _, name := range actionNames(results.Actions) {
+		result := results.Actions[name]
+		output := result.Output
+		if !result.Succeeded {
+			output = result.Logs
+		}
+		rows = append(rows, []string{
+			name,
+			actionStatus(result),
+			durationCell(result.Execution),
+			summarize(output, TABLE_SUMMARY_LENGTH),
+		})
+	}
+	return rndr.table([]string{"ACTION", "STATUS", "DURATION", "OUTPUT"}, rows), nil
+}
+
+func (rndr tableRenderer) observationTable(observations map[string]operation.ObservationResult) string {
+	rows := make([][]string, 0, len(observations))
+	for _, name := range observationNames(observations) {
+		result := observations[name]
+		rows = append(rows, []string{
+			name,
+			observationStatus(result),
+			durationCell(result.Execution),
+			summarize(result.Result, TABLE_SUMMARY_LENGTH),
+		})
+	}
+	return rndr.table([]string{"OBSERVATION", "STATUS", "DURATION", "RESULT"}, rows)
+}
+
+// Lines up the columns, with the second column (always the status)
+// colored if color is on. Colors are added after padding, escape codes
+// would throw off the widths otherwise.
+func (rndr tableRenderer) table(header []string, rows [][]string) string {
+	widths := make([]int, len(header))
+	for _, row := range append([][]string{header}, rows...) {
+		for column, cell := range row {
+			if length := utf8.RuneCountInString(cell); length > widths[column] {
+				widths[column] = length
+			}
+		}
+	}
+	var output strings.Builder
+	for row_index, row := range append([][]string{header}, rows...) {
+		var cells []string
+		for column, cell := range row {
+			if column < len(row)-1 {
+				cell += strings.Repeat(" ", widths[column]-utf8.RuneCountInString(cell))
+			}
+			if rndr.color && column == 1 && row_index > 0 {
+				cell = status_colors[row[column]] + cell + ansi_reset
+			}
+			cells = append(cells, cell)
+		}
+		output.WriteString(strings.TrimRight(strings.Join(cells, "  "), " "))
+		output.WriteString("\n")
+	}
+	return output.String()
+}
+
+func durationCell(execution operation.Execution) string {
+	if execution.Started_At == "" {
+		return "-"
+	}
+	if execution.Duration_Ms == 0 {
+		return "<1ms"
+	}
+	return duration(execution.Duration_Ms).String()
+}
+
+func observationSummary(observations map[string]operation.ObservationResult) string {
+	counts := make(map[string]int)
+	for _, result := range observations {
+		counts[observationStatus(result)]++
+	}
+	return fmt.Sprintf("%d observations: %d ok, %d failed, %d unexpected\n",
+		len(observations),
+		counts[STATUS_OK],
+		counts[STATUS_FAILED]+counts[STATUS_TIMED_OUT],
+		counts[STATUS_UNEXPECTED],
+	)
+}
+
+func reactionSummary(reactions map[string]operation.ReactionResult) string {
+	counts := make(map[string]int)
+	for _, result := range reactions {
+		counts[reactionStatus(result)]++
+	}
+	summary := fmt.Sprintf("%d reactions: %d ok, %d failed, %d skipped",
+		len(reactions),
+		counts[STATUS_OK],
+		counts[STATUS_FAILED]+counts[STATUS_TIMED_OUT],
+		counts[STATUS_SKIPPED],
+	)
+	if would_run := counts[STATUS_WOULD_RUN] + counts[STATUS_WOULD_CHANGE]; would_run > 0 {
+		summary += fmt.Sprintf(", %d would run", would_run)
+	}
+	if no_change := counts[STATUS_NO_CHANGE]; no_change > 0 {
+		summary += fmt.Sprintf(", %d would not change anything", no_change)
+	}
+	return summary + "\n"
+}
+
+func timingSummary(timing operation.RunTiming) string {
+	if timing.Started_At == "" {
+		return ""
+	}
+	return fmt.Sprintf("Took %s on %s\n", duration(timing.Duration_Ms), timing.Hostname)
+}
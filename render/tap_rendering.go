@@ -0,0 +1,139 @@
+package render
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/puppetlabs/regulator/operation"
+	"github.com/puppetlabs/regulator/rgerror"
+	"gopkg.in/yaml.v2"
+)
+
+// TAP version 13, one test point per observation, reaction, or action.
+// Anything that isn't ok gets a YAML diagnostic block with the details,
+// and reactions that were skipped, or only planned, use the SKIP directive.
+type tapRenderer struct{}
+
+type tapPoint struct {
+	ok          bool
+	description string
+	directive   string
+	diagnostic  yaml.MapSlice
+}
+
+func (rndr tapRenderer) RenderObservations(results *operation.ObservationResults) (string, *rgerror.RGerror) {
+	return renderTap(observationPoints(results.Observations))
+}
+
+func (rndr tapRenderer) RenderReactions(results *operation.ReactionResults) (string, *rgerror.RGerror) {
+	points := observationPoints(results.Observations)
+	for _, name := range reactionNames(results) {
+		result := results.Reactions[name]
+		status := reactionStatus(result)
+		point := tapPoint{
+			ok:          !isFailure(status),
+			description: "reaction " + name,
+		}
+		switch status {
+		case STATUS_SKIPPED:
+			point.directive = "SKIP " + result.Message
+		case STATUS_WOULD_RUN, STATUS_WOULD_CHANGE, STATUS_NO_CHANGE:
+			point.directive = "SKIP " + status
+		}
+		if !point.ok {
+			point.diagnostic = yaml.MapSlice{
+				{Key: "status", Value: status},
+				{Key: "message", Value: result.Message},
+				{Key: "action", Value: result.Reaction.Action},
+				{Key: "output", Value: result.Output},
+				{Key: "logs", Value: result.Logs},
+			}
+		}
+		points = append(points, point)
+	}
+	return renderTap(points)
+}
+
+func (rndr tapRenderer) RenderActions(results *operation.ActionResults) (string, *rgerror.RGerror) {
+	var points []tapPoint
+	for _, name := range actionNames(results.Actions) {
+		result := results.Actions[name]
+		status := actionStatus(result)
+		point := tapPoint{
+			ok:          !isFailure(status),
+			description: "action " + name,
+		}
+		if !point.ok {
+			point.diagnostic = yaml.MapSlice{
+				{Key: "status", Value: status},
+				{Key: "output", Value: result.Output},
+				{Key: "logs", Value: result.Logs},
+			}
+		}
+		points = append(points, point)
+	}
+	return renderTap(points)
+}
+
+func observationPoints(observations map[string]operation.ObservationResult) []tapPoint {
+	var points []tapPoint
+	for _, name := range observationNames(observations) {
+		result := observations[name]
+		status := observationStatus(result)
+		point := tapPoint{
+			ok:          !isFailure(status),
+			description: "observation " + name,
+		}
+		if !point.ok {
+			point.diagnostic = yaml.MapSlice{
+				{Key: "status", Value: status},
+				{Key: "result", Value: result.Result},
+				{Key: "expect", Value: result.Observation.Expect},
+				{Key: "logs", Value: result.Logs},
+			}
+		}
+		points = append(points, point)
+	}
+	return points
+}
+
+func renderTap(points []tapPoint) (string, *rgerror.RGerror) {
+	var output strings.Builder
+	output.WriteString("TAP version 13\n")
+	output.WriteString(fmt.Sprintf("1..%d\n", len(points)))
+	for index, point := range points {
+		status := "ok"
+		if !point.ok {
+			status = "not ok"
+		}
+		line := fmt.Sprintf("%s %d - %s", status, index+1, tapEscape(point.description))
+		if point.directive != "" {
+			line += " # " + tapEscape(summarize(point.directive, TABLE_SUMMARY_LENGTH))
+		}
+		output.WriteString(line + "\n")
+		if len(point.diagnostic) == 0 {
+			continue
+		}
+		yaml_output, yaml_err := yaml.Marshal(point.diagnostic)
+		if yaml_err != nil {
+			return "", &rgerror.RGerror{
+				Kind:    rgerror.ExecError,
+				Message: fmt.Sprintf("Could not render result as TAP: %s\n", yaml_err),
+				Origin:  yaml_err,
+			}
+		}
+		output.WriteString("  ---\n")
+		for _, yaml_line := range strings.Split(strings.TrimRight(string(yaml_output), "\n"), "\n") {
+			output.WriteString("  " + yaml_line + "\n")
+		}
+		output.WriteString("  ...\n")
+	}
+	return output.String(), nil
+}
+
+// '#' starts a directive and descriptions are a single line
+func tapEscape(text string) string {
+	text = strings.ReplaceAll(text, "\\", "\\\\")
+	text = strings.ReplaceAll(text, "#", "\\#")
+	return strings.Join(strings.Fields(text), " ")
+}
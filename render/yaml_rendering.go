@@ -0,0 +1,35 @@
+package render
+
+import (
+	"fmt"
+
+	"github.com/puppetlabs/regulator/operation"
+	"github.com/puppetlabs/regulator/rgerror"
+	"gopkg.in/yaml.v2"
+)
+
+func RenderYaml(data interface{}) (string, *rgerror.RGerror) {
+	yaml_output, yaml_err := yaml.Marshal(data)
+	if yaml_err != nil {
+		return "", &rgerror.RGerror{
+			Kind:    rgerror.ExecError,
+			Message: fmt.Sprintf("Could not render result as YAML: %s\n", yaml_err),
+			Origin:  yaml_err,
+		}
+	}
+	return string(yaml_output), nil
+}
+
+type yamlRenderer struct{}
+
+func (rndr yamlRenderer) RenderObservations(results *operation.ObservationResults) (string, *rgerror.RGerror) {
+	return RenderYaml(results)
+}
+
+func (rndr yamlRenderer) RenderReactions(results *operation.ReactionResults) (string, *rgerror.RGerror) {
+	return RenderYaml(results)
+}
+
+func (rndr yamlRenderer) RenderActions(results *operation.ActionResults) (string, *rgerror.RGerror) {
+	return RenderYaml(results)
+}
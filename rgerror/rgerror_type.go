@@ -2,6 +2,8 @@ package rgerror
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 )
 
 type RGerrorType int
@@ -12,24 +14,121 @@ const (
 	CompletedError
 	InvalidInput
 	RemoteExecError
+	ValidationError
+	TimeoutError
+	EscalationError
 )
 
 func (ar RGerrorType) String() string {
-	return []string{"Shell command failed:", "Execution failed:", "Already done:", "Invalid input:", "Remote execution failed:"}[ar]
+	return []string{"Shell command failed:", "Execution failed:", "Already done:", "Invalid input:", "Remote execution failed:", "Validation failed:", "Timed out:", "Privilege escalation failed:"}[ar]
+}
+
+// A name for the kind that won't change, for machines to match on (e.g.
+// the kind in --error-format json) instead of the text from String
+func (ar RGerrorType) Name() string {
+	return []string{"shell_error", "exec_error", "completed_error", "invalid_input", "remote_exec_error", "validation_error", "timeout_error", "escalation_error"}[ar]
+}
+
+// Kinds are errors themselves so they can be the target of errors.Is,
+// e.g. errors.Is(err, rgerror.TimeoutError)
+func (ar RGerrorType) Error() string {
+	return ar.String()
 }
 
 // RGerror is a custom error type that provides a
 // Kind field for parsing different error types.
+//
+// ValidationErrors carry every problem found in a spec as Findings
+// so they can all be fixed in one go.
 type RGerror struct {
-	Kind    RGerrorType
-	Message string
-	Origin  error
+	Kind     RGerrorType
+	Message  string
+	Origin   error
+	Findings []Finding
+	// The operation the error is about, if there is one, e.g.
+	// "action 'restart nginx'"
+	Operation string
+	// What might fix it, if there's anything more useful to say than
+	// the message already does
+	Hint string
+}
+
+// A single problem found while validating a spec
+type Finding struct {
+	// What sort of problem this is, e.g. "empty", "conflict" or "invalid"
+	Kind string `json:"kind"`
+	// The type and name of the operation with the problem, if any
+	Operation_Type string `json:"operation_type,omitempty"`
+	Operation      string `json:"operation,omitempty"`
+	// Where the operation is defined, Line is 0 if it isn't known
+	File    string `json:"file,omitempty"`
+	Line    int    `json:"line,omitempty"`
+	Message string `json:"message"`
+}
+
+func (fnd Finding) String() string {
+	location := fnd.File
+	if location == "" {
+		location = "unknown source"
+	} else if fnd.Line > 0 {
+		location = fmt.Sprintf("%s:%d", fnd.File, fnd.Line)
+	}
+	return fmt.Sprintf("%s: [%s] %s", location, fnd.Kind, fnd.Message)
+}
+
+// Builds a ValidationError out of a list of findings, sorted by where
+// they were found so the output reads top to bottom through each file
+func NewValidationError(findings []Finding) *RGerror {
+	sorted := append([]Finding{}, findings...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].File != sorted[j].File {
+			return sorted[i].File < sorted[j].File
+		}
+		if sorted[i].Line != sorted[j].Line {
+			return sorted[i].Line < sorted[j].Line
+		}
+		return sorted[i].Message < sorted[j].Message
+	})
+	problems := "problems"
+	if len(sorted) == 1 {
+		problems = "problem"
+	}
+	return &RGerror{
+		Kind:     ValidationError,
+		Message:  fmt.Sprintf("Found %d %s in spec", len(sorted), problems),
+		Origin:   nil,
+		Findings: sorted,
+	}
 }
 
 func (e *RGerror) Error() string {
+	message := e.Message
+	if len(e.Findings) > 0 {
+		var lines []string
+		for _, finding := range e.Findings {
+			lines = append(lines, "  - "+finding.String())
+		}
+		message = fmt.Sprintf("%s:\n%s", e.Message, strings.Join(lines, "\n"))
+	}
+	if e.Hint != "" {
+		message = fmt.Sprintf("%s\n\nHint: %s", message, e.Hint)
+	}
 	if e.Origin != nil {
-		return fmt.Sprintf("%s\n%s\n\nTrace:\n%s\n", e.Kind, e.Message, e.Origin)
+		return fmt.Sprintf("%s\n%s\n\nTrace:\n%s\n", e.Kind, message, e.Origin)
 	} else {
-		return fmt.Sprintf("%s\n%s\n", e.Kind, e.Message)
+		return fmt.Sprintf("%s\n%s\n", e.Kind, message)
 	}
 }
+
+// The error this one was caused by, for errors.Unwrap, errors.Is, and
+// errors.As
+func (e *RGerror) Unwrap() error {
+	return e.Origin
+}
+
+// An RGerror is its Kind, so errors.Is(err, rgerror.InvalidInput) is true
+// for any InvalidInput RGerror anywhere in err's chain
+func (e *RGerror) Is(target error) bool {
+	kind, ok := target.(RGerrorType)
+	return ok && e.Kind == kind
+}
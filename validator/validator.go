@@ -1,92 +1,180 @@
 package validator
 
 import (
-	"encoding/json"
 	"fmt"
-	"path/filepath"
+	"net"
+	"os"
 	"regexp"
+	"strconv"
+	"strings"
 
 	"github.com/puppetlabs/regulator/rgerror"
 )
 
-// Validators should take a string that looks something like:
+// Validates parameters (mostly CLI arguments and flags) before they're
+// used, something like:
 //
-// {"name":"input_param","value":"some_value_to_validate","validate":["NotEmpty","IsNumber"]}
+//	rgerr := validator.Validate(
+//		validator.Param{Name: "target", Value: target, Rules: []validator.Rule{validator.NotEmpty, validator.IsHost}},
+//		validator.Param{Name: "port", Value: port, Rules: []validator.Rule{validator.NotEmpty, validator.IsPort}},
+//	)
+//
+// Every parameter is checked, so one error can say everything that's wrong.
+// A parameter's rules are checked in order and stop at the first that
+// fails, later rules can count on the earlier ones having passed.
+type Param struct {
+	// How the parameter is known to whoever passed it, e.g. "--file"
+	Name  string
+	Value string
+	Rules []Rule
+}
+
+// Checks a value, returning what's wrong with it or "" if nothing is.
+// Problems read as the end of a sentence about the parameter, e.g.
+// "is empty".
+type Rule func(value string) string
+
+// One parameter that didn't pass one of its rules
+type Failure struct {
+	Param   string
+	Value   string
+	Problem string
+}
+
+func (flr Failure) String() string {
+	return fmt.Sprintf("'%s' %s", flr.Param, flr.Problem)
+}
 
-type Validator struct {
-	Name     string   `json:"name"`
-	Value    string   `json:"value"`
-	Validate []string `json:"validate"`
+// Every parameter that fails one of its rules, with the first rule it
+// failed
+func Check(params ...Param) []Failure {
+	var failures []Failure
+	for _, param := range params {
+		for _, rule := range param.Rules {
+			if problem := rule(param.Value); problem != "" {
+				failures = append(failures, Failure{Param: param.Name, Value: param.Value, Problem: problem})
+				break
+			}
+		}
+	}
+	return failures
 }
 
-func ValidateParams(params string) *rgerror.RGerror {
-	unmarshald_data := []Validator{}
-	// YAML would have been more human readable, but the use of whitespace in
-	// yaml as an actual separator makes it really ugly to create docstrings
-	// with yaml in them (which is the primary way this is meant to be used:
-	// you pass this function a json docstring that identifies what to
-	// validate
-	err := json.Unmarshal([]byte(params), &unmarshald_data)
-	if err != nil {
+// The same as Check, as an InvalidInput error that lists every failure.
+// Returns nil if everything passed.
+func Validate(params ...Param) *rgerror.RGerror {
+	failures := Check(params...)
+	if len(failures) == 0 {
+		return nil
+	}
+	if len(failures) == 1 {
 		return &rgerror.RGerror{
-			Kind:    rgerror.ExecError,
-			Message: fmt.Sprintf("Failed to parse validator as yaml:\n%s", err),
-			Origin:  err,
+			Kind:    rgerror.InvalidInput,
+			Message: failures[0].String(),
+			Origin:  nil,
 		}
 	}
-	for _, data := range unmarshald_data {
-		for _, validate_type := range data.Validate {
-			switch validate_type {
-			case "NotEmpty":
-				if !(len(data.Value) > 0) {
-					return &rgerror.RGerror{
-						Kind:    rgerror.InvalidInput,
-						Message: fmt.Sprintf("'%s' is empty", data.Name),
-						Origin:  nil,
-					}
-				}
-			case "IsNumber":
-				matcher, _ := regexp.Compile(`^[\d]+$`)
-				if !matcher.Match([]byte(data.Value)) {
-					return &rgerror.RGerror{
-						Kind:    rgerror.InvalidInput,
-						Message: fmt.Sprintf("'%s' is not a number, given %s", data.Name, data.Value),
-						Origin:  nil,
-					}
-				}
-			case "IsIP":
-				matcher, _ := regexp.Compile(`^[\d\.]+$`)
-				if !matcher.Match([]byte(data.Value)) {
-					return &rgerror.RGerror{
-						Kind:    rgerror.InvalidInput,
-						Message: fmt.Sprintf("'%s' is not an IP address, given %s", data.Name, data.Value),
-						Origin:  nil,
-					}
-				}
-			case "IsFile":
-				files, err := filepath.Glob(data.Value)
-				if err != nil {
-					return &rgerror.RGerror{
-						Kind:    rgerror.InvalidInput,
-						Message: fmt.Sprintf("Failed attempting to check if '%s' is a file or directory, failure:\n%s", data.Name, err),
-						Origin:  nil,
-					}
-				}
-				if len(files) < 1 {
-					return &rgerror.RGerror{
-						Kind:    rgerror.InvalidInput,
-						Message: fmt.Sprintf("'%s' is not a file or directory, given %s", data.Name, data.Value),
-						Origin:  nil,
-					}
-				}
-			default:
-				return &rgerror.RGerror{
-					Kind:    rgerror.ExecError,
-					Message: fmt.Sprintf("Unknown matcher: %s", validate_type),
-					Origin:  nil,
-				}
-			}
+	lines := make([]string, 0, len(failures))
+	for _, failure := range failures {
+		lines = append(lines, "  - "+failure.String())
+	}
+	return &rgerror.RGerror{
+		Kind:    rgerror.InvalidInput,
+		Message: fmt.Sprintf("Found %d invalid parameters:\n%s", len(failures), strings.Join(lines, "\n")),
+		Origin:  nil,
+	}
+}
+
+// ---------------------------------------------------------------
+
+// Rules
+// ---------------------------------------------------------------
+func NotEmpty(value string) string {
+	if value == "" {
+		return "is empty"
+	}
+	return ""
+}
+
+// A whole number, with no sign
+var number_matcher *regexp.Regexp = regexp.MustCompile(`^\d+$`)
+
+func IsNumber(value string) string {
+	if !number_matcher.MatchString(value) {
+		return fmt.Sprintf("is not a number, given %s", value)
+	}
+	return ""
+}
+
+// An IPv4 or IPv6 address
+func IsIP(value string) string {
+	if net.ParseIP(value) == nil {
+		return fmt.Sprintf("is not an IP address, given %s", value)
+	}
+	return ""
+}
+
+// A DNS hostname (RFC 1123): dot separated labels of letters, digits, and
+// hyphens that don't start or end with a hyphen, with an optional
+// trailing dot
+var hostname_label_matcher *regexp.Regexp = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?$`)
+
+func IsHostname(value string) string {
+	problem := fmt.Sprintf("is not a hostname, given %s", value)
+	hostname := strings.TrimSuffix(value, ".")
+	if hostname == "" || len(hostname) > 253 {
+		return problem
+	}
+	for _, label := range strings.Split(hostname, ".") {
+		if !hostname_label_matcher.MatchString(label) {
+			return problem
+		}
+	}
+	return ""
+}
+
+// Something that can be connected to: an IP address or a hostname
+func IsHost(value string) string {
+	if IsIP(value) == "" || IsHostname(value) == "" {
+		return ""
+	}
+	return fmt.Sprintf("is not an IP address or hostname, given %s", value)
+}
+
+func IsPort(value string) string {
+	port, err := strconv.Atoi(value)
+	if !number_matcher.MatchString(value) || err != nil || port < 1 || port > 65535 {
+		return fmt.Sprintf("is not a port number (1-65535), given %s", value)
+	}
+	return ""
+}
+
+// A file that exists and isn't a directory
+func IsFile(value string) string {
+	info, err := os.Stat(value)
+	if err != nil || info.IsDir() {
+		return fmt.Sprintf("is not a file, given %s", value)
+	}
+	return ""
+}
+
+func IsDir(value string) string {
+	info, err := os.Stat(value)
+	if err != nil || !info.IsDir() {
+		return fmt.Sprintf("is not a directory, given %s", value)
+	}
+	return ""
+}
+
+// The whole value has to match pattern, which is compiled when the rule
+// is made so a bad pattern panics straight away. description says what
+// the pattern is looking for, e.g. "a lowercase name".
+func MatchesRegex(pattern string, description string) Rule {
+	matcher := regexp.MustCompile(`^(?:` + pattern + `)$`)
+	return func(value string) string {
+		if !matcher.MatchString(value) {
+			return fmt.Sprintf("is not %s, given %s", description, value)
 		}
+		return ""
 	}
-	return nil
 }